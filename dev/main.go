@@ -2,9 +2,12 @@ package main
 
 import (
     "fmt"
+    "os"
     // "io/ioutil"
+    "github.com/eddiejessup/gnex/diag"
     "github.com/eddiejessup/gnex/read"
     "github.com/eddiejessup/gnex/lex"
+    "github.com/eddiejessup/gnex/tfm"
 )
 
 
@@ -22,17 +25,39 @@ func readTest() {
     fmt.Println()
 
     for {
-        v, err := r.ReadByte()
+        v, err := r.ReadFancyByte()
         if err != nil {
             break
         }
-        fmt.Printf("%v:%v\t%#U, %v\n", r.LineNr, r.ColNr, v, err)
+        fmt.Printf("%v:%v:%v\t%#U, %v\n", v.ReaderName, v.LineNr, v.ColNr, v.B, err)
     }
 }
 
-func defaultCatCodes() map[byte]lex.CatCode {
-    catCodes := make(map[byte]lex.CatCode)
-    for i := byte(0); i < 128; i++ {
+func tfmTest() {
+    finder := tfm.NewFontFinderFromEnv(".")
+    font, err := finder.LoadFont("cmr10")
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    fmt.Printf("%v\n", font)
+}
+
+func tfmCheck(name string) {
+    finder := tfm.NewFontFinderFromEnv(".")
+    font, err := finder.LoadFont(name)
+    if err != nil {
+        fmt.Println(err)
+        return
+    }
+    for _, d := range font.Validate() {
+        fmt.Printf("%v: %v\n", name, d)
+    }
+}
+
+func defaultCatCodes() map[rune]lex.CatCode {
+    catCodes := make(map[rune]lex.CatCode)
+    for i := rune(0); i < 128; i++ {
         var cat lex.CatCode
         switch {
             case i == '\\':
@@ -44,10 +69,6 @@ func defaultCatCodes() map[byte]lex.CatCode {
             // Null.
             case i == 0:
                 cat = lex.Ignored
-            // Line feed.
-            // NON-STANDARD
-            case i == 10:
-                cat = lex.EndOfLine
             // Carriage return.
             case i == 13:
                 cat = lex.EndOfLine
@@ -67,7 +88,7 @@ func defaultCatCodes() map[byte]lex.CatCode {
 }
 
 func catterTest() {
-    r := read.NestedByteReaderFromPath("outer.txt")
+    r := read.NestedByteReaderFromPathLines("outer.txt", read.NewLineConfig())
     catCodes := defaultCatCodes()
     catter := lex.NewCatter(r, catCodes)
 
@@ -83,15 +104,16 @@ func catterTest() {
 }
 
 func lexerTest() {
-    r := read.NestedByteReaderFromPath("outer.txt")
+    r := read.NestedByteReaderFromPathLines("outer.txt", read.NewLineConfig())
     catCodes := defaultCatCodes()
     catter := lex.NewCatter(r, catCodes)
     lexer := lex.NewLexer(*catter)
+    context := diag.NewContext(diag.NewFileSource("outer.txt"))
 
     for {
         tok, err := lexer.ReadToken()
         if err != nil {
-            fmt.Println(err)
+            context.Fprint(os.Stdout, err)
             break
         }
         fmt.Printf("%v %v\n", tok, err)
@@ -141,7 +163,7 @@ func (l *YaLexer) Error(s string) {
 
 
 func yaccTest() {
-    r := read.NestedByteReaderFromPath("parsetest.txt")
+    r := read.NestedByteReaderFromPathLines("parsetest.txt", read.NewLineConfig())
     catCodes := defaultCatCodes()
     catter := lex.NewCatter(r, catCodes)
     lexer := lex.NewLexer(*catter)
@@ -162,5 +184,19 @@ func yaccTest() {
 func main() {
     // catterTest()
     // lexerTest()
+    // tfmTest()
+    if len(os.Args) > 1 {
+        switch os.Args[1] {
+            case "tfmcheck":
+                if len(os.Args) < 3 {
+                    fmt.Fprintln(os.Stderr, "usage: dev tfmcheck font...")
+                    os.Exit(2)
+                }
+                for _, name := range os.Args[2:] {
+                    tfmCheck(name)
+                }
+                return
+        }
+    }
     yaccTest()
 }
@@ -0,0 +1,287 @@
+// Package diag reports errors the way TeX does, showing where in its input
+// the error arose: the line read so far, the rest of the line below it, and
+// the files that input the file being read.
+package diag
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/eddiejessup/gnex/read"
+	"github.com/eddiejessup/gnex/vfs"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Default line lengths for context, as in TeX Live's texmf.cnf.
+const (
+	DefaultErrorLine     = 79
+	DefaultHalfErrorLine = 50
+)
+
+// Pos is a place in the input, as the readers record it for each character.
+// Lines and columns count from zero, as the readers count them; reports
+// number lines from one, as TeX does.
+type Pos struct {
+	ReaderName string
+	Position   int
+	LineNr     int
+	ColNr      int
+	// Length is the number of characters the erroneous input spans, which
+	// may be zero if it is not known.
+	Length int
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("%v:%v:%v", p.ReaderName, p.LineNr+1, p.ColNr+1)
+}
+
+// Positioned is an error that knows where in the input it arose.
+type Positioned interface {
+	error
+	Pos() Pos
+}
+
+// Source gives the text of the lines of the inputs named in positions, as
+// they are in the input, without line ends.
+type Source interface {
+	Line(readerName string, lineNr int) (line []byte, ok bool)
+}
+
+// splitLines splits bs into lines as TeX reads them: each is ended by a line
+// feed, carriage return or both, and loses its trailing spaces.
+func splitLines(bs []byte) [][]byte {
+	var lines [][]byte
+	for len(bs) > 0 {
+		i := bytes.IndexAny(bs, "\r\n")
+		line := bs
+		if i < 0 {
+			bs = nil
+		} else {
+			line = bs[:i]
+			if bs[i] == '\r' && i+1 < len(bs) && bs[i+1] == '\n' {
+				i++
+			}
+			bs = bs[i+1:]
+		}
+		lines = append(lines, bytes.TrimRight(line, " "))
+	}
+	return lines
+}
+
+// MemorySource is a Source of inputs held in memory, by name.
+type MemorySource map[string][]byte
+
+func (s MemorySource) Line(readerName string, lineNr int) ([]byte, bool) {
+	bs, ok := s[readerName]
+	if !ok {
+		return nil, false
+	}
+	lines := splitLines(bs)
+	if lineNr < 0 || lineNr >= len(lines) {
+		return nil, false
+	}
+	return lines[lineNr], true
+}
+
+// FileSource is a Source of files, which are named in positions by their
+// base names, as the readers name them. Each file is read when one of its
+// lines is first asked for.
+type FileSource struct {
+	fsys  fs.FS
+	mu    sync.Mutex
+	paths map[string]string
+	lines map[string][][]byte
+}
+
+// NewFileSource returns a FileSource for the files at paths.
+func NewFileSource(paths ...string) *FileSource {
+	return NewFileSourceFS(vfs.OS, paths...)
+}
+
+// NewFileSourceFS returns a FileSource for the files at paths in fsys.
+func NewFileSourceFS(fsys fs.FS, paths ...string) *FileSource {
+	s := &FileSource{fsys: fsys, paths: make(map[string]string), lines: make(map[string][][]byte)}
+	for _, p := range paths {
+		s.Add(p)
+	}
+	return s
+}
+
+// Add makes the file at p available, under its base name.
+func (s *FileSource) Add(p string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := path.Base(p)
+	s.paths[name] = p
+	delete(s.lines, name)
+}
+
+func (s *FileSource) Line(readerName string, lineNr int) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines, ok := s.lines[readerName]
+	if !ok {
+		p, known := s.paths[readerName]
+		if !known {
+			return nil, false
+		}
+		bs, err := fs.ReadFile(s.fsys, p)
+		if err != nil {
+			return nil, false
+		}
+		lines = splitLines(bs)
+		s.lines[readerName] = lines
+	}
+	if lineNr < 0 || lineNr >= len(lines) {
+		return nil, false
+	}
+	return lines[lineNr], true
+}
+
+// Context formats errors with the context of the input where they arose.
+type Context struct {
+	Source Source
+	// Stack, if set, gives the files that input the file being read.
+	Stack *read.InputStack
+	// Runes says whether columns count UTF-8 encoded code points, as
+	// readers in rune mode count them, rather than bytes.
+	Runes bool
+	// Translation, if set, is used to print the input, so that characters
+	// that are not printable are shown in ^^ notation.
+	Translation *read.Translation
+	// ErrorLine is the most characters shown of a line of context, and
+	// HalfErrorLine the most shown of the text read so far, as TeX's
+	// error_line and half_error_line.
+	ErrorLine     int
+	HalfErrorLine int
+}
+
+// NewContext returns a Context that takes its lines from source.
+func NewContext(source Source) *Context {
+	return &Context{Source: source, ErrorLine: DefaultErrorLine, HalfErrorLine: DefaultHalfErrorLine}
+}
+
+// chars splits line into the characters that columns count, each as it is
+// printed.
+func (c *Context) chars(line []byte) []string {
+	var cs []string
+	for len(line) > 0 {
+		var r rune
+		size := 1
+		if c.Runes {
+			r, size = utf8.DecodeRune(line)
+		} else {
+			r = rune(line[0])
+		}
+		if c.Translation != nil {
+			if !c.Runes {
+				r = c.Translation.Ord(line[0])
+			}
+			cs = append(cs, string(c.Translation.AppendPrint(nil, r)))
+		} else {
+			cs = append(cs, string(line[:size]))
+		}
+		line = line[size:]
+	}
+	return cs
+}
+
+func width(cs []string) (n int) {
+	for _, c := range cs {
+		n += utf8.RuneCountInString(c)
+	}
+	return n
+}
+
+// contextLines returns TeX's two lines of context for a position in line:
+// the label and the text read, which ends with the erroneous input, and
+// below it the text remaining, starting where the first line ends. Long
+// lines are cut short with an ellipsis, as TeX does. The carets mark the
+// erroneous input, or where it is if its length is not known.
+func (c *Context) contextLines(label string, line []byte, pos Pos) (seen, rest, carets string) {
+	cs := c.chars(line)
+	start := pos.ColNr
+	if start > len(cs) {
+		start = len(cs)
+	}
+	end := start + pos.Length
+	if end > len(cs) {
+		end = len(cs)
+	}
+	before, marked, after := cs[:start], cs[start:end], cs[end:]
+
+	// Keep as much of the text read as fits, dropping it from the left.
+	var prefix string
+	if len(label)+width(before)+width(marked) > c.HalfErrorLine {
+		prefix = "..."
+		for len(before) > 0 && len(label)+len(prefix)+width(before)+width(marked) > c.HalfErrorLine {
+			before = before[1:]
+		}
+	}
+	seen = label + prefix + strings.Join(before, "") + strings.Join(marked, "")
+
+	// Keep as much of the text remaining as fits, dropping it from the right.
+	indent := utf8.RuneCountInString(seen)
+	var suffix string
+	if indent+width(after) > c.ErrorLine {
+		suffix = "..."
+		for len(after) > 0 && indent+width(after)+len(suffix) > c.ErrorLine {
+			after = after[:len(after)-1]
+		}
+	}
+	rest = strings.Repeat(" ", indent) + strings.Join(after, "") + suffix
+
+	n := width(marked)
+	carets = strings.Repeat(" ", indent-n) + "^"
+	if n > 1 {
+		carets += strings.Repeat("~", n-1)
+	}
+	return seen, rest, carets
+}
+
+// Format returns err as TeX would report it at pos: the files that input
+// the file, the message, and the context of the line.
+func (c *Context) Format(err error, pos Pos) string {
+	var b strings.Builder
+	if c.Stack != nil {
+		frames := c.Stack.Frames()
+		if len(frames) > 0 && frames[len(frames)-1].Name == pos.ReaderName {
+			frames = frames[:len(frames)-1]
+		}
+		for i := len(frames) - 1; i >= 0; i-- {
+			fmt.Fprintf(&b, "In file included from %v:%v\n", frames[i].Name, frames[i].LineNr)
+		}
+	}
+	fmt.Fprintf(&b, "%v: %v\n", pos, err)
+	if c.Source == nil {
+		return b.String()
+	}
+	line, ok := c.Source.Line(pos.ReaderName, pos.LineNr)
+	if !ok {
+		return b.String()
+	}
+	seen, rest, carets := c.contextLines(fmt.Sprintf("l.%v ", pos.LineNr+1), line, pos)
+	b.WriteString(strings.TrimRight(seen, " ") + "\n")
+	b.WriteString(strings.TrimRight(rest, " ") + "\n")
+	b.WriteString(carets + "\n")
+	return b.String()
+}
+
+// FormatError formats err with its context if it knows where it arose, and
+// as a bare message otherwise.
+func (c *Context) FormatError(err error) string {
+	if p, ok := err.(Positioned); ok {
+		return c.Format(err, p.Pos())
+	}
+	return err.Error() + "\n"
+}
+
+// Fprint writes err to w as FormatError formats it.
+func (c *Context) Fprint(w io.Writer, err error) error {
+	_, werr := io.WriteString(w, c.FormatError(err))
+	return werr
+}
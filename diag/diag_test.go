@@ -0,0 +1,205 @@
+package diag
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/eddiejessup/gnex/read"
+	"github.com/eddiejessup/gnex/vfs"
+)
+
+func TestContextLines(t *testing.T) {
+	const line = `\hbox to \foo bar baz`
+	tests := []struct {
+		name                 string
+		line                 string
+		colNr, length        int
+		errorLine, halfError int
+		runes                bool
+		translation          *read.Translation
+		seen, rest, carets   string
+	}{
+		{"split", line, 9, 4, 79, 50, false, nil,
+			`l.1 \hbox to \foo`,
+			`                  bar baz`,
+			`             ^~~~`},
+		{"length unknown", line, 9, 0, 79, 50, false, nil,
+			`l.1 \hbox to `,
+			`             \foo bar baz`,
+			`             ^`},
+		{"first character", line, 0, 5, 79, 50, false, nil,
+			`l.1 \hbox`,
+			`          to \foo bar baz`,
+			`    ^~~~~`},
+		{"last character", line, 20, 1, 79, 50, false, nil,
+			`l.1 \hbox to \foo bar baz`,
+			`                         `,
+			`                        ^`},
+		{"past the end", "ab", 7, 2, 79, 50, false, nil,
+			`l.1 ab`,
+			`      `,
+			`      ^`},
+		{"text read cut short", line, 9, 4, 79, 12, false, nil,
+			`l.1 ... \foo`,
+			`             bar baz`,
+			`        ^~~~`},
+		{"text remaining cut short", line, 9, 4, 17, 12, false, nil,
+			`l.1 ... \foo`,
+			`             b...`,
+			`        ^~~~`},
+		{"marked text longer than half a line", line, 0, 13, 79, 12, false, nil,
+			`l.1 ...\hbox to \foo`,
+			`                     bar baz`,
+			`       ^~~~~~~~~~~~~`},
+		{"bytes", "é\\foo", 2, 4, 79, 50, false, nil,
+			"l.1 é\\foo",
+			"         ",
+			"     ^~~~"},
+		{"runes", "é\\foo", 1, 4, 79, 50, true, nil,
+			"l.1 é\\foo",
+			"         ",
+			"     ^~~~"},
+		{"printed", "\x01\\foo", 1, 4, 79, 50, false, read.NewTranslation("test"),
+			"l.1 ^^A\\foo",
+			"           ",
+			"       ^~~~"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Context{ErrorLine: test.errorLine, HalfErrorLine: test.halfError,
+				Runes: test.runes, Translation: test.translation}
+			pos := Pos{ColNr: test.colNr, Length: test.length}
+			seen, rest, carets := c.contextLines("l.1 ", []byte(test.line), pos)
+			if seen != test.seen || rest != test.rest || carets != test.carets {
+				t.Errorf("got\n%q\n%q\n%q\nwant\n%q\n%q\n%q",
+					seen, rest, carets, test.seen, test.rest, test.carets)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	src := MemorySource{"foo.tex": []byte("first\n\\hbox to \\foo bar baz   \r\nlast")}
+	errUndefined := errors.New("Undefined control sequence")
+	tests := []struct {
+		name   string
+		source Source
+		pos    Pos
+		want   string
+	}{
+		{"context", src, Pos{ReaderName: "foo.tex", LineNr: 1, ColNr: 9, Length: 4},
+			"foo.tex:2:10: Undefined control sequence\n" +
+				"l.2 \\hbox to \\foo\n" +
+				"                  bar baz\n" +
+				"             ^~~~\n"},
+		{"end of line", src, Pos{ReaderName: "foo.tex", LineNr: 2, ColNr: 3, Length: 1},
+			"foo.tex:3:4: Undefined control sequence\n" +
+				"l.3 last\n" +
+				"\n" +
+				"       ^\n"},
+		{"no source", nil, Pos{ReaderName: "foo.tex", LineNr: 1},
+			"foo.tex:2:1: Undefined control sequence\n"},
+		{"missing input", src, Pos{ReaderName: "bar.tex", LineNr: 1},
+			"bar.tex:2:1: Undefined control sequence\n"},
+		{"input too short", src, Pos{ReaderName: "foo.tex", LineNr: 3},
+			"foo.tex:4:1: Undefined control sequence\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := NewContext(test.source)
+			if got := c.Format(errUndefined, test.pos); got != test.want {
+				t.Errorf("got\n%v\nwant\n%v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatIncludedFrom(t *testing.T) {
+	stack := read.NewInputStack(&read.LineConfig{EndLineChar: '\r'})
+	for _, f := range []struct{ name, text string }{
+		{"main.tex", "a\nb"},
+		{"ch1.tex", "c"},
+		{"sec.tex", "d"},
+	} {
+		if err := stack.Push(f.name, strings.NewReader(f.text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewContext(nil)
+	c.Stack = stack
+	tests := []struct {
+		name string
+		pos  Pos
+		want string
+	}{
+		{"current file", Pos{ReaderName: "sec.tex"},
+			"In file included from ch1.tex:1\n" +
+				"In file included from main.tex:1\n" +
+				"sec.tex:1:1: x\n"},
+		{"not a file", Pos{ReaderName: "pseudo"},
+			"In file included from sec.tex:1\n" +
+				"In file included from ch1.tex:1\n" +
+				"In file included from main.tex:1\n" +
+				"pseudo:1:1: x\n"},
+	}
+	for _, test := range tests {
+		if got := c.Format(errors.New("x"), test.pos); got != test.want {
+			t.Errorf("%v: got\n%v\nwant\n%v", test.name, got, test.want)
+		}
+	}
+}
+
+type positionedError struct{ pos Pos }
+
+func (e positionedError) Error() string { return "bad" }
+func (e positionedError) Pos() Pos      { return e.pos }
+
+func TestFormatError(t *testing.T) {
+	c := NewContext(MemorySource{"a.tex": []byte("xyz")})
+	if got, want := c.FormatError(errors.New("plain")), "plain\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	got := c.FormatError(positionedError{Pos{ReaderName: "a.tex", ColNr: 1, Length: 1}})
+	if want := "a.tex:1:2: bad\nl.1 xy\n      z\n     ^\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	fsys := vfs.NewMemFS(map[string][]byte{
+		"dir/a.tex": []byte("one\r\ntwo  \n\nfour"),
+	})
+	s := NewFileSourceFS(fsys, "dir/a.tex", "dir/missing.tex")
+	tests := []struct {
+		name   string
+		lineNr int
+		want   string
+		ok     bool
+	}{
+		{"a.tex", 0, "one", true},
+		{"a.tex", 1, "two", true},
+		{"a.tex", 2, "", true},
+		{"a.tex", 3, "four", true},
+		{"a.tex", 4, "", false},
+		{"a.tex", -1, "", false},
+		{"missing.tex", 0, "", false},
+		{"dir/a.tex", 0, "", false},
+	}
+	for _, test := range tests {
+		got, ok := s.Line(test.name, test.lineNr)
+		if ok != test.ok || string(got) != test.want {
+			t.Errorf("%v line %v: got %q, %v, want %q, %v", test.name, test.lineNr, got, ok, test.want, test.ok)
+		}
+	}
+
+	// Adding a file again reads it again.
+	fsys.WriteFile("dir/a.tex", []byte("new"))
+	if got, _ := s.Line("a.tex", 0); string(got) != "one" {
+		t.Errorf("got %q before adding the file again, want the lines read before", got)
+	}
+	s.Add("dir/a.tex")
+	if got, _ := s.Line("a.tex", 0); string(got) != "new" {
+		t.Errorf("got %q after adding the file again, want \"new\"", got)
+	}
+}
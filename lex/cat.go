@@ -2,17 +2,25 @@ package lex
 
 import (
 	"fmt"
+	"github.com/eddiejessup/gnex/diag"
 	"github.com/eddiejessup/gnex/read"
 )
 
 type CatterError struct {
 	msg string
+	pos diag.Pos
 }
 
 func (p CatterError) Error() string {
 	return p.msg
 }
 
+// Pos returns where the character that caused the error was read, which is
+// not known for characters that were only peeked at.
+func (p CatterError) Pos() diag.Pos {
+	return p.pos
+}
+
 type CatCode string
 
 const (
@@ -34,13 +42,17 @@ const (
 	Invalid     CatCode = "Invalid"
 )
 
+// Catter assigns categories to the characters it reads. In byte mode, as in
+// classic TeX, each byte is a character; in rune mode, as in XeTeX and
+// LuaTeX, each UTF-8 encoded code point is.
 type Catter struct {
 	reader     read.FancyByteReader
-	CatCodeMap map[byte]CatCode
+	runeReader read.FancyRuneReader
+	CatCodeMap map[rune]CatCode
 }
 
 type CharCat struct {
-	Char       byte
+	Char       rune
 	Cat        CatCode
 	ReaderName string
 	Position   int
@@ -49,41 +61,90 @@ type CharCat struct {
 	Length     int
 }
 
-func NewCatter(r read.FancyByteReader, catCodes map[byte]CatCode) *Catter {
+// Pos returns where the character was read.
+func (cc CharCat) Pos() diag.Pos {
+	return diag.Pos{ReaderName: cc.ReaderName, Position: cc.Position,
+		LineNr: cc.LineNr, ColNr: cc.ColNr, Length: cc.Length}
+}
+
+// NewCatter returns a Catter in byte mode.
+func NewCatter(r read.FancyByteReader, catCodes map[rune]CatCode) *Catter {
 	return &Catter{reader: r, CatCodeMap: catCodes}
 }
 
-func (p *Catter) CharToCat(char byte) (cat CatCode, err error) {
+// NewRuneCatter returns a Catter in rune mode, in which categories can be
+// assigned to any code point.
+func NewRuneCatter(r read.FancyRuneReader, catCodes map[rune]CatCode) *Catter {
+	return &Catter{runeReader: r, CatCodeMap: catCodes}
+}
+
+// CharToCat returns the category assigned to a character. In rune mode, a
+// code point beyond ASCII that has none is Other, as in XeTeX.
+func (p *Catter) CharToCat(char rune) (cat CatCode, err error) {
 	cat, ok := p.CatCodeMap[char]
-	if !ok {
+	if !ok && p.runeReader != nil && char >= 128 {
+		cat = Other
+	} else if !ok {
 		err = CatterError{msg: fmt.Sprintf("Character has no category assigned: '%#U'", char)}
 	}
 	return
 }
 
-func (p *Catter) ReadCharCat() (cc CharCat, err error) {
-	fancyByte, err := p.reader.ReadFancyByte()
-	if err != nil {
-		return
+// readChar reads the next character, in whichever mode the Catter is in,
+// with its position.
+func (p *Catter) readChar() (cc CharCat, err error) {
+	if p.runeReader != nil {
+		fancyRune, err := p.runeReader.ReadFancyRune()
+		if err != nil {
+			return cc, err
+		}
+		return CharCat{
+			Char:       fancyRune.R,
+			ReaderName: fancyRune.ReaderName,
+			Position:   fancyRune.Position,
+			LineNr:     fancyRune.LineNr,
+			ColNr:      fancyRune.ColNr,
+		}, nil
 	}
-	cat, err := p.CharToCat(fancyByte.B)
+	fancyByte, err := p.reader.ReadFancyByte()
 	if err != nil {
 		return
 	}
-	cc = CharCat{
-		Char:       fancyByte.B,
-		Cat:        cat,
+	return CharCat{
+		Char:       rune(fancyByte.B),
 		ReaderName: fancyByte.ReaderName,
 		Position:   fancyByte.Position,
 		LineNr:     fancyByte.LineNr,
 		ColNr:      fancyByte.ColNr,
-		Length: 1,
+	}, nil
+}
+
+// peekChar returns the nth character ahead, in whichever mode the Catter is
+// in.
+func (p *Catter) peekChar(n int) (char rune, err error) {
+	if p.runeReader != nil {
+		return p.runeReader.PeekRune(n)
+	}
+	b, err := p.reader.PeekByte(n)
+	return rune(b), err
+}
+
+func (p *Catter) ReadCharCat() (cc CharCat, err error) {
+	cc, err = p.readChar()
+	if err != nil {
+		return
+	}
+	cc.Length = 1
+	cc.Cat, err = p.CharToCat(cc.Char)
+	if e, ok := err.(CatterError); ok {
+		e.pos = cc.Pos()
+		err = e
 	}
 	return
 }
 
-func (p *Catter) PeekCharCat(n int) (char byte, cat CatCode, err error) {
-	char, err = p.reader.PeekByte(n)
+func (p *Catter) PeekCharCat(n int) (char rune, cat CatCode, err error) {
+	char, err = p.peekChar(n)
 	if err != nil {
 		return
 	}
@@ -94,7 +155,7 @@ func (p *Catter) PeekCharCat(n int) (char byte, cat CatCode, err error) {
 	return
 }
 
-func (p *Catter) peekCharCatTrio() (char byte, cat CatCode, triod bool, err error) {
+func (p *Catter) peekCharCatTrio() (char rune, cat CatCode, triod bool, err error) {
 	char1, cat1, err := p.PeekCharCat(1)
 	if err != nil {
 		return
@@ -107,9 +168,10 @@ func (p *Catter) peekCharCatTrio() (char byte, cat CatCode, triod bool, err erro
 	// - Next two characters have category 'superscript'
 	// - Next two characters are the same character
 	// - Third character does not have category 'end-of-line'
+	// - Third character is ASCII, which in rune mode it need not be
 	triod = (err2 == nil && err3 == nil &&
 		cat1 == Superscript && cat2 == cat1 &&
-		char2 == char1 && cat3 != EndOfLine)
+		char2 == char1 && cat3 != EndOfLine && char3 < 128)
 	if triod {
 		char = char3
 		if char >= 64 {
@@ -128,10 +190,14 @@ func (p *Catter) peekCharCatTrio() (char byte, cat CatCode, triod bool, err erro
 }
 
 func (p *Catter) ReadCharCatTrio() (cc CharCat, err error) {
-	char, cat, triod, err := p.peekCharCatTrio()
+	char, cat, triod, errPeek := p.peekCharCatTrio()
 	// Above function only peeks, so now actually advance by the correct number
-	// of bytes.
+	// of bytes. Reading also gives an error about the first character its
+	// position.
 	cc, err = p.ReadCharCat()
+	if err != nil {
+		return
+	}
 	if triod {
 		cc.Char = char
 		cc.Cat = cat
@@ -139,15 +205,21 @@ func (p *Catter) ReadCharCatTrio() (cc CharCat, err error) {
 
 		p.ReadCharCat()
 		p.ReadCharCat()
-	} else {
-		if cc.Char != char || cc.Cat != cat {
-			panic("Peeking and reading did not return same results")
+		// The character a trio stands for may have no category, even though
+		// the characters that make it up do.
+		if e, ok := errPeek.(CatterError); ok {
+			e.pos = cc.Pos()
+			err = e
 		}
+	} else if errPeek != nil {
+		err = errPeek
+	} else if cc.Char != char || cc.Cat != cat {
+		panic("Peeking and reading did not return same results")
 	}
 	return
 }
 
-func (p *Catter) PeekCharCatTrio() (char byte, cat CatCode, err error) {
+func (p *Catter) PeekCharCatTrio() (char rune, cat CatCode, err error) {
 	char, cat, _, err = p.peekCharCatTrio()
 	return
 }
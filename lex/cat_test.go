@@ -0,0 +1,169 @@
+package lex
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/eddiejessup/gnex/read"
+)
+
+var testCatCodes = map[rune]CatCode{
+	'\\':   Escape,
+	' ':    Space,
+	'\n':   EndOfLine,
+	'^':    Superscript,
+	'a':    Letter,
+	'b':    Letter,
+	'A':    Other,
+	'B':    Other,
+	'!':    Other,
+	'\x01': Other,
+}
+
+func TestReadCharCatTrio(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		char   rune
+		cat    CatCode
+		length int
+	}{
+		{"plain", "ab", 'a', Letter, 1},
+		{"trio", "^^A", '\x01', Other, 3},
+		{"trio below 64", "^^!", 'a', Letter, 3},
+		{"short", "^^", '^', Superscript, 1},
+		{"different", "^a", '^', Superscript, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := read.NestedByteReaderFromBytes("test", []byte(test.input))
+			cc, err := NewCatter(r, testCatCodes).ReadCharCatTrio()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cc.Char != test.char || cc.Cat != test.cat || cc.Length != test.length {
+				t.Errorf("got %q %v length %v, want %q %v length %v",
+					cc.Char, cc.Cat, cc.Length, test.char, test.cat, test.length)
+			}
+		})
+	}
+}
+
+func TestReadCharCatTrioNoCategory(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		runeMode bool
+		colNr    int
+		length   int
+	}{
+		{"byte", "a~", false, 1, 1},
+		{"rune", "a~", true, 1, 1},
+		{"trio", "a^^B", false, 1, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := read.NestedByteReaderFromBytes("test", []byte(test.input))
+			catter := NewCatter(r, testCatCodes)
+			if test.runeMode {
+				catter = NewRuneCatter(r, testCatCodes)
+			}
+			if _, err := catter.ReadCharCatTrio(); err != nil {
+				t.Fatal(err)
+			}
+			_, err := catter.ReadCharCatTrio()
+			e, ok := err.(CatterError)
+			if !ok {
+				t.Fatalf("got error %v, want a CatterError", err)
+			}
+			if pos := e.Pos(); pos.ColNr != test.colNr || pos.Length != test.length {
+				t.Errorf("got column %v length %v, want column %v length %v",
+					pos.ColNr, pos.Length, test.colNr, test.length)
+			}
+		})
+	}
+}
+
+func TestCharToCatRuneDefault(t *testing.T) {
+	tests := []struct {
+		char     rune
+		runeMode bool
+		cat      CatCode
+		ok       bool
+	}{
+		{'a', false, Letter, true},
+		{'a', true, Letter, true},
+		{'~', true, "", false},
+		{'é', false, "", false},
+		{'é', true, Other, true},
+		{'Ā', true, Other, true},
+	}
+	for _, test := range tests {
+		r := read.NestedByteReaderFromBytes("test", nil)
+		catter := NewCatter(r, testCatCodes)
+		if test.runeMode {
+			catter = NewRuneCatter(r, testCatCodes)
+		}
+		cat, err := catter.CharToCat(test.char)
+		if (err == nil) != test.ok || cat != test.cat {
+			t.Errorf("%q in rune mode %v: got %v, %v, want %v", test.char, test.runeMode, cat, err, test.cat)
+		}
+	}
+}
+
+func TestEscapeAtEndOfInput(t *testing.T) {
+	r := read.NestedByteReaderFromBytes("test", []byte("a\\"))
+	lexer := NewLexer(*NewCatter(r, testCatCodes))
+	if _, err := lexer.ReadToken(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := lexer.ReadToken()
+	e, ok := err.(LexError)
+	if !ok {
+		t.Fatalf("got error %v, want a LexError", err)
+	}
+	if pos := e.Pos(); pos.ReaderName != "test" || pos.ColNr != 1 {
+		t.Errorf("got position %+v, want column 1 of test", pos)
+	}
+}
+
+func TestReadCharCatTrioStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		reader   func() *read.NestedByteReader
+		runeMode bool
+		want     string
+	}{
+		{"stream", func() *read.NestedByteReader {
+			return read.NestedByteReaderFromReader("test", strings.NewReader("abab"))
+		}, false, "abab"},
+		{"stream, rune mode", func() *read.NestedByteReader {
+			return read.NestedByteReaderFromReader("test", strings.NewReader("abab"))
+		}, true, "abab"},
+		{"lines", func() *read.NestedByteReader {
+			return read.NestedByteReaderFromLines("test", strings.NewReader("ab\nab"), &read.LineConfig{EndLineChar: '\n'})
+		}, false, "ab\nab\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := test.reader()
+			catter := NewCatter(r, testCatCodes)
+			if test.runeMode {
+				catter = NewRuneCatter(r, testCatCodes)
+			}
+			var got []rune
+			for {
+				cc, err := catter.ReadCharCatTrio()
+				if _, ok := err.(read.ExhaustedError); ok {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, cc.Char)
+			}
+			if string(got) != test.want {
+				t.Errorf("read %q, want %q", string(got), test.want)
+			}
+		})
+	}
+}
@@ -2,16 +2,25 @@ package lex
 
 import (
 	"fmt"
+	"github.com/eddiejessup/gnex/diag"
+	"github.com/eddiejessup/gnex/read"
+	"io"
 )
 
 type LexError struct {
 	msg string
+	pos diag.Pos
 }
 
 func (p LexError) Error() string {
 	return p.msg
 }
 
+// Pos returns where the input that caused the error was read.
+func (p LexError) Pos() diag.Pos {
+	return p.pos
+}
+
 type ReadState string
 
 const (
@@ -31,6 +40,12 @@ type ControlSequenceCall struct {
 	Length     int
 }
 
+// Pos returns where the control sequence was read.
+func (p ControlSequenceCall) Pos() diag.Pos {
+	return diag.Pos{ReaderName: p.ReaderName, Position: p.Position,
+		LineNr: p.LineNr, ColNr: p.ColNr, Length: p.Length}
+}
+
 type Lexer struct {
 	catter    Catter
 	readState ReadState
@@ -72,7 +87,9 @@ func (p *Lexer) ReadToken() (tok Token, err error) {
 				tokLength := cc.Length
 				ccNameFirst, err := p.catter.ReadCharCatTrio()
 				// If escape character is at end of file, no idea what to do.
-				if err != nil {
+				if _, ok := err.(read.ExhaustedError); ok || err == io.EOF {
+					return tok, LexError{msg: "Escape character at end of input", pos: cc.Pos()}
+				} else if err != nil {
 					return tok, err
 				}
 				tokLength += ccNameFirst.Length
@@ -0,0 +1,266 @@
+package read
+
+import (
+    "fmt"
+    "github.com/eddiejessup/gnex/vfs"
+    "io"
+    "io/fs"
+    "path"
+    "strings"
+)
+
+// DefaultMaxInputDepth is the number of files that can be open at once, as
+// TeX's max_in_open.
+const DefaultMaxInputDepth = 15
+
+type InputError struct {
+    msg string
+}
+
+func (p InputError) Error() string {
+    return p.msg
+}
+
+// InputFrame describes a file on an InputStack.
+type InputFrame struct {
+    Name string
+    // LineNr is the number, from 1, of the line being read in the file.
+    LineNr int
+}
+
+// inputFile is a file on an InputStack, which takes it off the stack once it
+// has been read to the end, and what its stack's EveryEOF returns has been
+// read after it.
+type inputFile struct {
+    stack *InputStack
+    stream *StreamByteReader
+    r *NestedByteReader
+}
+
+func (f *inputFile) exhausted(err error) error {
+    if _, ok := err.(ExhaustedError); ok {
+        f.stack.pop(f)
+    }
+    return err
+}
+
+func (f *inputFile) inheritTranslation(t *Translation) {
+    f.r.inheritTranslation(t)
+}
+
+func (f *inputFile) ReadFancyByte() (FancyByte, error) {
+    v, err := f.r.ReadFancyByte()
+    return v, f.exhausted(err)
+}
+
+func (f *inputFile) ReadByte() (byte, error) {
+    v, err := f.ReadFancyByte()
+    return v.B, err
+}
+
+func (f *inputFile) PeekByte(n int) (byte, error) {
+    return f.r.PeekByte(n)
+}
+
+func (f *inputFile) ReadFancyRune() (FancyRune, error) {
+    v, err := f.r.ReadFancyRune()
+    return v, f.exhausted(err)
+}
+
+func (f *inputFile) ReadRune() (rune, int, error) {
+    v, err := f.ReadFancyRune()
+    return v.R, v.Size, err
+}
+
+func (f *inputFile) PeekRune(n int) (rune, error) {
+    return f.r.PeekRune(n)
+}
+
+// InputStack is the stack of files that TeX reads from, as \input adds to
+// it. Each file is read a line at a time, and each has its own line numbers.
+// Reading from the stack reads from the file most recently input, until it
+// ends and reading carries on in the file that input it.
+type InputStack struct {
+    reader *NestedByteReader
+    files []*inputFile
+    config *LineConfig
+    // Dirs are the directories searched for files named without a
+    // directory, in order.
+    Dirs []string
+    // MaxDepth is the number of files that can be open at once.
+    MaxDepth int
+    // EveryEOF, if set, says what is read as each file ends.
+    EveryEOF EveryEOF
+    // FS is the file system files are found and opened in.
+    FS fs.FS
+}
+
+// NewInputStack returns an empty InputStack that reads files with config,
+// looking for them in the current directory.
+func NewInputStack(config *LineConfig) *InputStack {
+    return &InputStack{
+        reader: &NestedByteReader{Name: "input stack"},
+        config: config,
+        Dirs: []string{"."},
+        MaxDepth: DefaultMaxInputDepth,
+        FS: vfs.OS,
+    }
+}
+
+// Resolve returns the path of the file that \input name reads. As in TeX,
+// a name without an extension is first tried with .tex added. A name that
+// includes a directory is not searched for in Dirs.
+func (s *InputStack) Resolve(name string) (string, error) {
+    candidates := []string{name}
+    if path.Ext(name) == "" {
+        candidates = []string{name + ".tex", name}
+    }
+    dirs := s.Dirs
+    if strings.ContainsRune(name, '/') {
+        dirs = []string{""}
+    }
+    for _, dir := range dirs {
+        for _, c := range candidates {
+            p := path.Join(dir, c)
+            if vfs.IsFile(s.FS, p) {
+                return p, nil
+            }
+        }
+    }
+    return "", InputError{msg: fmt.Sprintf("I can't find file `%v'", name)}
+}
+
+// Input starts reading the file name, as \input does, before whatever is
+// left to read.
+func (s *InputStack) Input(name string) error {
+    p, err := s.Resolve(name)
+    if err != nil {
+        return err
+    }
+    r, err := s.FS.Open(p)
+    if err != nil {
+        return err
+    }
+    if err := s.Push(path.Base(p), r); err != nil {
+        r.Close()
+        return err
+    }
+    return nil
+}
+
+// Push starts reading from r, named name, as if it were a file that had been
+// input. It is closed, if it is an io.Closer, when it has been read.
+func (s *InputStack) Push(name string, r io.Reader) error {
+    return s.push(NewLineStreamByteReader(name, r, s.config))
+}
+
+// ScanTokens starts reading bs as a pseudo-file named name, as e-TeX's
+// \scantokens does. It is read like a file, and is on the stack like one.
+func (s *InputStack) ScanTokens(name string, bs []byte) error {
+    return s.push(newPseudoFileStream(name, bs, s.config))
+}
+
+func (s *InputStack) push(stream *StreamByteReader) error {
+    if len(s.files) >= s.MaxDepth {
+        return InputError{msg: fmt.Sprintf("TeX capacity exceeded, sorry [text input levels=%v]", s.MaxDepth)}
+    }
+    // The stack's EveryEOF is consulted as the file ends, as it may have
+    // changed since the file was input.
+    everyEOF := func() []byte {
+        if s.EveryEOF == nil {
+            return nil
+        }
+        return s.EveryEOF()
+    }
+    f := &inputFile{stack: s, stream: stream, r: withEveryEOF(stream.Name, stream, everyEOF)}
+    s.files = append(s.files, f)
+    s.reader.Insert(f)
+    return nil
+}
+
+func (s *InputStack) pop(f *inputFile) {
+    for i := len(s.files) - 1; i >= 0; i-- {
+        if s.files[i] == f {
+            s.files = append(s.files[:i], s.files[i+1:]...)
+            return
+        }
+    }
+}
+
+// EndInput makes the current file end once its current line has been read,
+// as \endinput does.
+func (s *InputStack) EndInput() {
+    if len(s.files) > 0 {
+        s.files[len(s.files)-1].stream.endAfterLine()
+    }
+}
+
+// Depth returns the number of files open.
+func (s *InputStack) Depth() int {
+    return len(s.files)
+}
+
+// InputLineNo returns the number, from 1, of the line being read in the
+// current file, as \inputlineno does, or 0 if no file is open.
+func (s *InputStack) InputLineNo() int {
+    if len(s.files) == 0 {
+        return 0
+    }
+    return s.files[len(s.files)-1].stream.LineNr + 1
+}
+
+// Frames returns the open files, the current one last.
+func (s *InputStack) Frames() []InputFrame {
+    frames := make([]InputFrame, len(s.files))
+    for i, f := range s.files {
+        frames[i] = InputFrame{Name: f.stream.Name, LineNr: f.stream.LineNr + 1}
+    }
+    return frames
+}
+
+// Trace describes where reading has got to, as in
+// "l.12 in file foo.tex included from l.3 in file bar.tex".
+func (s *InputStack) Trace() string {
+    frames := s.Frames()
+    var parts []string
+    for i := len(frames) - 1; i >= 0; i-- {
+        parts = append(parts, fmt.Sprintf("l.%v in file %v", frames[i].LineNr, frames[i].Name))
+    }
+    return strings.Join(parts, " included from ")
+}
+
+// SetTranslation makes t map the bytes of the files on the stack, and of
+// those input later, to internal codes, as TeX's xord does. If t is nil,
+// bytes are read as they are.
+func (s *InputStack) SetTranslation(t *Translation) {
+    s.reader.Translation = t
+}
+
+// Translation returns the stack's Translation, if it has one.
+func (s *InputStack) Translation() *Translation {
+    return s.reader.Translation
+}
+
+func (s *InputStack) ReadFancyByte() (FancyByte, error) {
+    return s.reader.ReadFancyByte()
+}
+
+func (s *InputStack) ReadByte() (byte, error) {
+    return s.reader.ReadByte()
+}
+
+func (s *InputStack) PeekByte(n int) (byte, error) {
+    return s.reader.PeekByte(n)
+}
+
+func (s *InputStack) ReadFancyRune() (FancyRune, error) {
+    return s.reader.ReadFancyRune()
+}
+
+func (s *InputStack) ReadRune() (rune, int, error) {
+    return s.reader.ReadRune()
+}
+
+func (s *InputStack) PeekRune(n int) (rune, error) {
+    return s.reader.PeekRune(n)
+}
@@ -0,0 +1,162 @@
+package read
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/eddiejessup/gnex/vfs"
+)
+
+func testInputStack() *InputStack {
+    s := NewInputStack(&LineConfig{EndLineChar: '|'})
+    s.FS = vfs.NewMemFS(map[string][]byte{
+        "a.tex": []byte("one\ntwo\nthree"),
+        "b": []byte("bare"),
+        "b.tex": []byte("b with .tex"),
+        "e": []byte("e"),
+        "dir/c.tex": []byte("c"),
+        "other/d.tex": []byte("d"),
+    })
+    s.Dirs = []string{".", "other"}
+    return s
+}
+
+func TestInputStackResolve(t *testing.T) {
+    tests := []struct {
+        name string
+        want string
+    }{
+        {"a", "a.tex"},
+        {"a.tex", "a.tex"},
+        {"b", "b.tex"},
+        {"e", "e"},
+        {"d", "other/d.tex"},
+        {"dir/c", "dir/c.tex"},
+        {"c", ""},
+        {"other/a", ""},
+        {"missing", ""},
+    }
+    s := testInputStack()
+    for _, test := range tests {
+        got, err := s.Resolve(test.name)
+        if test.want == "" {
+            if _, ok := err.(InputError); !ok {
+                t.Errorf("%v: got %q, %v, want an InputError", test.name, got, err)
+            }
+        } else if err != nil || got != test.want {
+            t.Errorf("%v: got %q, %v, want %q", test.name, got, err, test.want)
+        }
+    }
+}
+
+func TestInputStackInput(t *testing.T) {
+    s := testInputStack()
+    if err := s.Input("d"); err != nil {
+        t.Fatal(err)
+    }
+    fb, err := s.ReadFancyByte()
+    if err != nil || fb.B != 'd' || fb.ReaderName != "d.tex" {
+        t.Errorf("got %+v, %v, want 'd' from d.tex", fb, err)
+    }
+    if err := s.Input("missing"); err == nil {
+        t.Error("input a missing file")
+    }
+    if got := s.Depth(); got != 1 {
+        t.Errorf("got depth %v, want 1", got)
+    }
+}
+
+func TestInputStackTrace(t *testing.T) {
+    s := testInputStack()
+    if got := s.InputLineNo(); got != 0 {
+        t.Errorf("got line %v with no file open, want 0", got)
+    }
+    if err := s.Input("a"); err != nil {
+        t.Fatal(err)
+    }
+    skipBytes(t, s, 5)
+    if got := s.InputLineNo(); got != 2 {
+        t.Errorf("got line %v, want 2", got)
+    }
+    if err := s.Input("e"); err != nil {
+        t.Fatal(err)
+    }
+    skipBytes(t, s, 1)
+    want := "l.1 in file e included from l.2 in file a.tex"
+    if got := s.Trace(); got != want {
+        t.Errorf("got trace %q, want %q", got, want)
+    }
+    // Reading the end of e takes it off the stack.
+    skipBytes(t, s, 2)
+    if got := s.Trace(); got != "l.2 in file a.tex" {
+        t.Errorf("got trace %q after e ended", got)
+    }
+}
+
+func TestInputStackEndInput(t *testing.T) {
+    tests := []struct {
+        name string
+        // skip is how many bytes of a.tex are read before \endinput.
+        skip int
+        want string
+    }{
+        {"start", 0, ""},
+        {"mid-line", 1, "ne|"},
+        {"end of line", 4, ""},
+        {"second line", 5, "wo|"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            s := testInputStack()
+            if err := s.Push("outer", strings.NewReader("x")); err != nil {
+                t.Fatal(err)
+            }
+            if err := s.Input("a"); err != nil {
+                t.Fatal(err)
+            }
+            skipBytes(t, s, test.skip)
+            s.EndInput()
+            want := test.want + "x|"
+            if got := string(readAllBytes(t, s)); got != want {
+                t.Errorf("read %q, want %q", got, want)
+            }
+            if got := s.Depth(); got != 0 {
+                t.Errorf("got depth %v at the end, want 0", got)
+            }
+        })
+    }
+}
+
+func TestInputStackMaxDepth(t *testing.T) {
+    s := testInputStack()
+    s.MaxDepth = 2
+    for i := 0; i < 2; i++ {
+        if err := s.Input("a"); err != nil {
+            t.Fatal(err)
+        }
+    }
+    err := s.Input("a")
+    if _, ok := err.(InputError); !ok || err.Error() != "TeX capacity exceeded, sorry [text input levels=2]" {
+        t.Errorf("got %v, want TeX's capacity error", err)
+    }
+    if got := s.Depth(); got != 2 {
+        t.Errorf("got depth %v, want 2", got)
+    }
+}
+
+func TestInputStackSetTranslation(t *testing.T) {
+    s := NewInputStack(&LineConfig{EndLineChar: -1})
+    if err := s.Push("file.tex", strings.NewReader("\x80\x80")); err != nil {
+        t.Fatal(err)
+    }
+    if got, _ := s.ReadByte(); got != 0x80 {
+        t.Errorf("read %q without a translation", got)
+    }
+    s.SetTranslation(testTranslation())
+    if got, _ := s.ReadByte(); got != 'A' {
+        t.Errorf("read %q after setting the translation, want 'A'", got)
+    }
+    if s.Translation() == nil {
+        t.Error("lost the translation")
+    }
+}
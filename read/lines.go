@@ -0,0 +1,197 @@
+package read
+
+import (
+    "bufio"
+    "errors"
+    "github.com/eddiejessup/gnex/vfs"
+    "io"
+    "io/fs"
+    "path"
+)
+
+// LineConfig holds the settings that TeX consults as it reads each line of
+// input. Readers sharing a LineConfig see changes to it from the next line
+// they read. It is not safe for concurrent use.
+type LineConfig struct {
+    // EndLineChar is appended to every line, as TeX's \endlinechar. If it is
+    // not between 0 and 255, such as -1, nothing is appended.
+    EndLineChar int
+    // NewLineChar ends the lines of pseudo-files, which are not ended by
+    // line feeds or carriage returns, as e-TeX's \newlinechar does for
+    // \scantokens. If it is not between 0 and 255, a pseudo-file is one line.
+    NewLineChar int
+}
+
+// NewLineConfig returns the settings of IniTeX, whose \endlinechar is
+// carriage return and whose \newlinechar is zero.
+func NewLineConfig() *LineConfig {
+    return &LineConfig{EndLineChar: '\r'}
+}
+
+// lineReader presents the contents of a file the way TeX sees them: a line at
+// a time, each ended by a line feed, carriage return or both, with trailing
+// spaces removed and the end-of-line character appended. A line is only
+// read once the previous one has been consumed, so it is ended with the
+// end-of-line character in force at that time. Until then, peeking stops at
+// the end of the line, as TeX cannot look beyond the line in its buffer.
+type lineReader struct {
+    r *bufio.Reader
+    source io.Reader
+    config *LineConfig
+    line []byte
+    eof bool
+    // offset is the number of bytes produced so far, and lineEnds the
+    // offsets at which the lines produced end, from the nPassed'th on not
+    // yet passed by the reader.
+    offset int
+    lineEnds []int
+    nPassed int
+    // keep is set while the reader may be reset, and so may pass lines
+    // again.
+    keep bool
+    // pseudo is set if the reader reads a pseudo-file, whose lines are ended
+    // by the configured new-line character.
+    pseudo bool
+    // peeking is set while the reader is peeked at, when it produces a new
+    // line only if held is not set. held says that the line it last
+    // produced has not been consumed.
+    peeking bool
+    held bool
+}
+
+// errLineHeld is returned by a lineReader that is asked for a new line while
+// it is held.
+var errLineHeld = errors.New("line not yet consumed")
+
+func newLineReader(r io.Reader, config *LineConfig) *lineReader {
+    return &lineReader{r: bufio.NewReader(r), source: r, config: config}
+}
+
+// endsLine returns whether b ends a line, given that the reader has just
+// read it.
+func (l *lineReader) endsLine(b byte) bool {
+    if l.pseudo {
+        return int(b) == l.config.NewLineChar
+    }
+    if b == '\r' {
+        if next, err := l.r.Peek(1); err == nil && next[0] == '\n' {
+            l.r.ReadByte()
+        }
+        return true
+    }
+    return b == '\n'
+}
+
+func (l *lineReader) Read(p []byte) (n int, err error) {
+    for len(l.line) == 0 {
+        if l.eof {
+            return 0, io.EOF
+        }
+        if l.peeking && l.held {
+            return 0, errLineHeld
+        }
+        if err = l.nextLine(); err != nil {
+            return 0, err
+        }
+        l.held = true
+    }
+    n = copy(p, l.line)
+    l.line = l.line[n:]
+    return n, nil
+}
+
+// nextLine reads the next line of the file, if there is one.
+func (l *lineReader) nextLine() error {
+    var line []byte
+    for {
+        b, err := l.r.ReadByte()
+        if err == io.EOF {
+            l.eof = true
+            // A final line need not be ended, but if nothing precedes the
+            // end of the file, there is no line.
+            if len(line) == 0 {
+                return nil
+            }
+            break
+        } else if err != nil {
+            return err
+        }
+        if l.endsLine(b) {
+            break
+        }
+        line = append(line, b)
+    }
+    for len(line) > 0 && line[len(line)-1] == ' ' {
+        line = line[:len(line)-1]
+    }
+    if c := l.config.EndLineChar; c >= 0 && c <= 255 {
+        line = append(line, byte(c))
+    }
+    l.line = line
+    l.offset += len(line)
+    l.lineEnds = append(l.lineEnds, l.offset)
+    return nil
+}
+
+// passed returns the number of line ends a reader at the offset has passed
+// since it last asked, and forgets those lines unless it is keeping them.
+func (l *lineReader) passed(offset int) (n int) {
+    // Lines left empty by an inactive end-of-line character end where the
+    // previous line does, and are passed at once.
+    for l.nPassed < len(l.lineEnds) && offset >= l.lineEnds[l.nPassed] {
+        l.nPassed++
+        n++
+    }
+    if !l.keep {
+        l.lineEnds = l.lineEnds[l.nPassed:]
+        l.nPassed = 0
+    }
+    return n
+}
+
+// nextEnd returns the offset at which the first line not yet passed ends, if
+// it has been produced.
+func (l *lineReader) nextEnd() (offset int, ok bool) {
+    if l.nPassed < len(l.lineEnds) {
+        return l.lineEnds[l.nPassed], true
+    }
+    return 0, false
+}
+
+func (l *lineReader) Close() error {
+    if c, ok := l.source.(io.Closer); ok {
+        return c.Close()
+    }
+    return nil
+}
+
+// NewLineStreamByteReader returns a StreamByteReader that reads r a line at a
+// time, as TeX reads a file, with config giving the end-of-line character.
+// Line numbers count the lines of r.
+func NewLineStreamByteReader(name string, r io.Reader, config *LineConfig) *StreamByteReader {
+    lr := newLineReader(r, config)
+    p := NewStreamByteReader(name, lr)
+    p.lines = lr
+    return p
+}
+
+func NestedByteReaderFromPathLines(p string, config *LineConfig) *NestedByteReader {
+    return NestedByteReaderFromFSLines(vfs.OS, p, config)
+}
+
+// NestedByteReaderFromFSLines returns a reader for the file p in fsys as TeX
+// sees it, a line at a time, which is empty if the file cannot be opened.
+func NestedByteReaderFromFSLines(fsys fs.FS, p string, config *LineConfig) *NestedByteReader {
+    name := path.Base(p)
+    r, err := fsys.Open(p)
+    if err != nil {
+        return NestedByteReaderFromBytes(name, nil)
+    }
+    return NestedByteReaderFromLines(name, r, config)
+}
+
+// NestedByteReaderFromLines returns a reader for the contents of r as TeX
+// sees them, a line at a time.
+func NestedByteReaderFromLines(name string, r io.Reader, config *LineConfig) *NestedByteReader {
+    return NestedByteReaderFromChild(name, NewLineStreamByteReader(name, r, config))
+}
@@ -0,0 +1,89 @@
+package read
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestLines(t *testing.T) {
+    tests := []struct {
+        name string
+        input string
+        endLineChar int
+        want string
+    }{
+        {"line feeds", "ab\ncd\n", '\r', "ab\rcd\r"},
+        {"unended last line", "ab\ncd", '\r', "ab\rcd\r"},
+        {"carriage returns", "ab\r\ncd\ref", '\r', "ab\rcd\ref\r"},
+        {"trailing spaces", "ab  \n  cd \n", '\r', "ab\r  cd\r"},
+        {"empty lines", "\n\nab", '\r', "\r\rab\r"},
+        {"no end-of-line character", "ab\ncd\n", -1, "abcd"},
+        {"other end-of-line character", "ab\ncd\n", '%', "ab%cd%"},
+        {"empty", "", '\r', ""},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            config := &LineConfig{EndLineChar: test.endLineChar}
+            r := NestedByteReaderFromLines("test", strings.NewReader(test.input), config)
+            if got := string(readAllBytes(t, r)); got != test.want {
+                t.Errorf("got %q, want %q", got, test.want)
+            }
+        })
+    }
+}
+
+func TestLineNumbers(t *testing.T) {
+    r := NestedByteReaderFromLines("test", strings.NewReader("ab\n\ncd"), NewLineConfig())
+    want := []struct{ b byte; lineNr, colNr int }{
+        {'a', 0, 0}, {'b', 0, 1}, {'\r', 0, 2},
+        {'\r', 1, 0},
+        {'c', 2, 0}, {'d', 2, 1}, {'\r', 2, 2},
+    }
+    for _, w := range want {
+        v, err := r.ReadFancyByte()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if v.B != w.b || v.LineNr != w.lineNr || v.ColNr != w.colNr {
+            t.Errorf("got %q at %v:%v, want %q at %v:%v", v.B, v.LineNr, v.ColNr, w.b, w.lineNr, w.colNr)
+        }
+    }
+}
+
+func TestEndLineCharChangedAfterPeek(t *testing.T) {
+    config := NewLineConfig()
+    r := NestedByteReaderFromLines("test", strings.NewReader("ab\ncd\n"), config)
+    if v, err := r.PeekByte(3); err != nil || v != '\r' {
+        t.Fatalf("peeked %q, %v, want '\\r'", v, err)
+    }
+    // Peeking does not read beyond the line that is being read.
+    if _, err := r.PeekByte(4); err == nil {
+        t.Errorf("peeked beyond the end of the line")
+    } else if _, ok := err.(ExhaustedError); ok {
+        t.Errorf("got %v, want an error that is not exhaustion", err)
+    }
+    for i := 0; i < 3; i++ {
+        r.ReadByte()
+    }
+    config.EndLineChar = -1
+    if got := string(readAllBytes(t, r)); got != "cd" {
+        t.Errorf("got %q, want \"cd\"", got)
+    }
+}
+
+func TestPeekRuneStopsAtLineEnd(t *testing.T) {
+    config := NewLineConfig()
+    r := NestedByteReaderFromLines("test", strings.NewReader("é\nü\n"), config)
+    if v, err := r.PeekRune(2); err != nil || v != '\r' {
+        t.Fatalf("peeked %q, %v, want '\\r'", v, err)
+    }
+    if _, err := r.PeekRune(3); err == nil {
+        t.Errorf("peeked beyond the end of the line")
+    }
+    r.ReadRune()
+    r.ReadRune()
+    config.EndLineChar = '%'
+    if got := string(readAllRunes(t, r)); got != "ü%" {
+        t.Errorf("got %q, want \"ü%%\"", got)
+    }
+}
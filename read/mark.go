@@ -0,0 +1,151 @@
+package read
+
+import (
+    "fmt"
+)
+
+// Mark is a saved state of a reader, to which it can be reset, so that what
+// was read after it was made is read again.
+type Mark struct {
+    reader interface{}
+    position int
+    tapePos int
+    lineNr int
+    colNr int
+    limit int
+    linesPassed int
+    contents []content
+    children []childMark
+    files []*inputFile
+    // unmarkable is a nested reader that could not be marked, if there is
+    // one.
+    unmarkable NestedChild
+}
+
+type childMark struct {
+    child Rewinder
+    mark Mark
+}
+
+// Rewinder is a reader that can be marked, and reset to a mark. A mark that
+// is no longer needed should be released, as a reader may hold on to what it
+// reads while it is marked, and must not be used after that.
+type Rewinder interface {
+    Mark() Mark
+    Reset(m Mark) error
+    Release(m Mark)
+}
+
+func wrongMark(name string) error {
+    return ValueError{msg: fmt.Sprintf("Cannot reset %v to a mark made by another reader", name)}
+}
+
+// Mark saves the state of the reader, including that of the readers nested
+// in it that are still to be read.
+func (p *NestedByteReader) Mark() Mark {
+    m := Mark{reader: p, position: p.Position, lineNr: p.LineNr, colNr: p.ColNr, contents: p.contents}
+    for i := p.Position; i < len(p.contents); i++ {
+        child := p.contents[i].child
+        if r, ok := child.(Rewinder); ok {
+            m.children = append(m.children, childMark{child: r, mark: r.Mark()})
+        } else if child != nil && m.unmarkable == nil {
+            m.unmarkable = child
+        }
+    }
+    return m
+}
+
+// Reset restores the reader to the state saved in m. Readers inserted since m
+// was made are removed. It fails if a nested reader that cannot be marked
+// was still to be read when m was made.
+func (p *NestedByteReader) Reset(m Mark) error {
+    if m.reader != p {
+        return wrongMark(p.Name)
+    }
+    if m.unmarkable != nil {
+        return ValueError{msg: fmt.Sprintf("Cannot reset %v, as it contains a reader that cannot be marked, %T", p.Name, m.unmarkable)}
+    }
+    for _, cm := range m.children {
+        if err := cm.child.Reset(cm.mark); err != nil {
+            return err
+        }
+    }
+    p.Position, p.LineNr, p.ColNr, p.contents = m.position, m.lineNr, m.colNr, m.contents
+    return nil
+}
+
+func (p *NestedByteReader) Release(m Mark) {
+    for _, cm := range m.children {
+        cm.child.Release(cm.mark)
+    }
+}
+
+// Mark saves the state of the reader, which from then on keeps what it reads
+// until the mark is released.
+func (p *StreamByteReader) Mark() Mark {
+    p.marks++
+    m := Mark{reader: p, position: p.Position, tapePos: p.tapePos, lineNr: p.LineNr, colNr: p.ColNr, limit: p.limit}
+    if p.lines != nil {
+        p.lines.keep = true
+        m.linesPassed = p.lines.nPassed
+    }
+    return m
+}
+
+func (p *StreamByteReader) Reset(m Mark) error {
+    if m.reader != p {
+        return wrongMark(p.Name)
+    }
+    p.Position, p.tapePos = m.position, m.tapePos
+    p.LineNr, p.ColNr, p.limit = m.lineNr, m.colNr, m.limit
+    if p.lines != nil {
+        p.lines.nPassed = m.linesPassed
+    }
+    return nil
+}
+
+func (p *StreamByteReader) Release(m Mark) {
+    if p.marks == 0 {
+        return
+    }
+    p.marks--
+    if p.marks == 0 && p.lines != nil {
+        p.lines.keep = false
+    }
+}
+
+func (f *inputFile) Mark() Mark {
+    return f.r.Mark()
+}
+
+func (f *inputFile) Reset(m Mark) error {
+    return f.r.Reset(m)
+}
+
+func (f *inputFile) Release(m Mark) {
+    f.r.Release(m)
+}
+
+// Mark saves the state of the stack, including which files are open.
+func (s *InputStack) Mark() Mark {
+    m := Mark{reader: s, files: append([]*inputFile(nil), s.files...)}
+    m.children = []childMark{{child: s.reader, mark: s.reader.Mark()}}
+    return m
+}
+
+// Reset restores the stack to the state saved in m, reopening files that have
+// been read to the end since, and ending those input since.
+func (s *InputStack) Reset(m Mark) error {
+    if m.reader != s {
+        return wrongMark("input stack")
+    }
+    if err := s.reader.Reset(m.children[0].mark); err != nil {
+        return err
+    }
+    s.files = append(s.files[:0:0], m.files...)
+    return nil
+}
+
+func (s *InputStack) Release(m Mark) {
+    s.reader.Release(m.children[0].mark)
+}
@@ -0,0 +1,186 @@
+package read
+
+import (
+    "strings"
+    "testing"
+)
+
+type markReader interface {
+    FancyByteReader
+    Rewinder
+}
+
+func readAllFancyBytes(t *testing.T, r FancyByteReader) []FancyByte {
+    var fbs []FancyByte
+    for {
+        fb, err := r.ReadFancyByte()
+        if _, ok := err.(ExhaustedError); ok {
+            return fbs
+        } else if err != nil {
+            t.Fatal(err)
+        }
+        fbs = append(fbs, fb)
+    }
+}
+
+func skipBytes(t *testing.T, r FancyByteReader, n int) {
+    for i := 0; i < n; i++ {
+        if _, err := r.ReadByte(); err != nil {
+            t.Fatalf("reading byte %v: %v", i, err)
+        }
+    }
+}
+
+type markTest struct {
+    name string
+    reader func() markReader
+    // before is how many bytes are read before marking, and after how many
+    // after, once between has been called.
+    before, after int
+    between func(r markReader)
+}
+
+var longInput = strings.Repeat("0123456789\n", 1000)
+
+var markTests = []markTest{
+    {"bytes", func() markReader {
+        return NestedByteReaderFromBytes("test", []byte("ab\ncd"))
+    }, 1, 3, nil},
+    {"inserted after mark", func() markReader {
+        return NestedByteReaderFromBytes("test", []byte("ab\ncd"))
+    }, 1, 5, func(r markReader) {
+        r.(*NestedByteReader).Insert(NewStreamByteReader("child", strings.NewReader("XYZ")))
+    }},
+    {"inserted before mark", func() markReader {
+        r := NestedByteReaderFromBytes("test", []byte("ab\ncd"))
+        r.Insert(NewStreamByteReader("child", strings.NewReader("XYZ")))
+        return r
+    }, 1, 4, nil},
+    {"nested reader inserted after mark", func() markReader {
+        return NestedByteReaderFromBytes("test", []byte("ab\ncd"))
+    }, 1, 5, func(r markReader) {
+        r.(*NestedByteReader).Insert(NestedByteReaderFromReader("child", strings.NewReader("XYZ")))
+    }},
+    {"nested twice", func() markReader {
+        inner := NestedByteReaderFromBytes("inner", []byte("12"))
+        inner.Insert(NestedByteReaderFromReader("innermost", strings.NewReader("XY")))
+        r := NestedByteReaderFromBytes("test", []byte("ab"))
+        r.Insert(inner)
+        return r
+    }, 1, 4, nil},
+    {"stream", func() markReader {
+        return NestedByteReaderFromReader("test", strings.NewReader(longInput))
+    }, 5, 8000, nil},
+    {"stream reader", func() markReader {
+        return NewStreamByteReader("test", strings.NewReader(longInput))
+    }, 5, 8000, nil},
+    {"input stack", func() markReader {
+        s := NewInputStack(&LineConfig{EndLineChar: '|'})
+        s.Push("a.tex", strings.NewReader("one\ntwo\nthree"))
+        return s
+    }, 2, 8, func(r markReader) {
+        r.(*InputStack).Push("b.tex", strings.NewReader("B"))
+    }},
+    {"input stack, file ended", func() markReader {
+        s := NewInputStack(&LineConfig{EndLineChar: '|'})
+        s.Push("a.tex", strings.NewReader("one\ntwo"))
+        s.Push("b.tex", strings.NewReader("B\nC"))
+        return s
+    }, 1, 6, nil},
+}
+
+// testMarkReset checks that what is read after resetting to a mark is what
+// a fresh reader reads, positions included.
+func testMarkReset(t *testing.T, tests []markTest) {
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            fresh := test.reader()
+            skipBytes(t, fresh, test.before)
+            want := readAllFancyBytes(t, fresh)
+
+            r := test.reader()
+            skipBytes(t, r, test.before)
+            m := r.Mark()
+            if test.between != nil {
+                test.between(r)
+            }
+            skipBytes(t, r, test.after)
+            if err := r.Reset(m); err != nil {
+                t.Fatal(err)
+            }
+            got := readAllFancyBytes(t, r)
+            r.Release(m)
+            if len(got) != len(want) {
+                t.Fatalf("read %v bytes after resetting, want %v", len(got), len(want))
+            }
+            for i := range got {
+                if got[i] != want[i] {
+                    t.Fatalf("byte %v: got %+v, want %+v", i, got[i], want[i])
+                }
+            }
+        })
+    }
+}
+
+func TestMarkReset(t *testing.T) {
+    testMarkReset(t, markTests)
+}
+
+func TestMarkInputStackDepth(t *testing.T) {
+    s := NewInputStack(&LineConfig{EndLineChar: '|'})
+    s.Push("a.tex", strings.NewReader("one\ntwo"))
+    skipBytes(t, s, 2)
+    m := s.Mark()
+    s.Push("b.tex", strings.NewReader("B"))
+    if got := s.Depth(); got != 2 {
+        t.Fatalf("got depth %v after pushing, want 2", got)
+    }
+    skipBytes(t, s, 6)
+    if err := s.Reset(m); err != nil {
+        t.Fatal(err)
+    }
+    if got := s.Depth(); got != 1 {
+        t.Errorf("got depth %v after resetting, want 1", got)
+    }
+    if got := s.InputLineNo(); got != 1 {
+        t.Errorf("got line number %v after resetting, want 1", got)
+    }
+}
+
+func TestMarkResetRepeatedly(t *testing.T) {
+    r := NestedByteReaderFromReader("test", strings.NewReader("abcdef"))
+    skipBytes(t, r, 1)
+    m := r.Mark()
+    for i := 0; i < 3; i++ {
+        skipBytes(t, r, i+1)
+        if err := r.Reset(m); err != nil {
+            t.Fatal(err)
+        }
+        var got []byte
+        for _, fb := range readAllFancyBytes(t, r) {
+            got = append(got, fb.B)
+        }
+        if string(got) != "bcdef" {
+            t.Errorf("reset %v: read %q, want \"bcdef\"", i, got)
+        }
+        if err := r.Reset(m); err != nil {
+            t.Fatal(err)
+        }
+    }
+    r.Release(m)
+}
+
+func TestMarkErrors(t *testing.T) {
+    a := NestedByteReaderFromBytes("a", []byte("ab"))
+    b := NestedByteReaderFromBytes("b", []byte("ab"))
+    if err := b.Reset(a.Mark()); err == nil {
+        t.Error("reset a reader to another's mark")
+    }
+
+    // A child hidden behind an interface that does not mark.
+    r := NestedByteReaderFromBytes("test", []byte("ab"))
+    r.Insert(struct{ FancyByteReader }{NewStreamByteReader("child", strings.NewReader("x"))})
+    if err := r.Reset(r.Mark()); err == nil {
+        t.Error("reset a reader with an unmarkable child")
+    }
+}
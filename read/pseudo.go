@@ -0,0 +1,103 @@
+package read
+
+import (
+    "bytes"
+)
+
+// EveryEOF returns what is read when a file ends, as e-TeX's \everyeof does.
+// It is called as the file ends, so it returns what is in force then.
+type EveryEOF func() []byte
+
+// EveryEOFName is the name given to what an EveryEOF returns.
+const EveryEOFName = "<everyeof>"
+
+// eofHook is a nested reader that reads what its hook returns, calling the
+// hook when it is first read from or peeked at.
+type eofHook struct {
+    hook EveryEOF
+    r *NestedByteReader
+}
+
+func (h *eofHook) reader() *NestedByteReader {
+    if h.r == nil {
+        h.r = NestedByteReaderFromBytes(EveryEOFName, h.hook())
+    }
+    return h.r
+}
+
+func (h *eofHook) ReadFancyByte() (FancyByte, error) {
+    return h.reader().ReadFancyByte()
+}
+
+func (h *eofHook) ReadByte() (byte, error) {
+    return h.reader().ReadByte()
+}
+
+func (h *eofHook) PeekByte(n int) (byte, error) {
+    return h.reader().PeekByte(n)
+}
+
+func (h *eofHook) ReadFancyRune() (FancyRune, error) {
+    return h.reader().ReadFancyRune()
+}
+
+func (h *eofHook) ReadRune() (rune, int, error) {
+    return h.reader().ReadRune()
+}
+
+func (h *eofHook) PeekRune(n int) (rune, error) {
+    return h.reader().PeekRune(n)
+}
+
+// Mark saves whether the hook has been called, so that resetting to a mark
+// made before it was calls it again.
+func (h *eofHook) Mark() Mark {
+    m := Mark{reader: h}
+    if h.r != nil {
+        m.children = []childMark{{child: h.r, mark: h.r.Mark()}}
+    }
+    return m
+}
+
+func (h *eofHook) Reset(m Mark) error {
+    if m.reader != h {
+        return wrongMark(EveryEOFName)
+    }
+    if len(m.children) == 0 {
+        h.r = nil
+        return nil
+    }
+    h.r = m.children[0].child.(*NestedByteReader)
+    return h.r.Reset(m.children[0].mark)
+}
+
+func (h *eofHook) Release(m Mark) {
+    for _, cm := range m.children {
+        cm.child.Release(cm.mark)
+    }
+}
+
+// withEveryEOF returns a reader for the contents of r, named name, followed by
+// what everyEOF returns, if it is set.
+func withEveryEOF(name string, r *StreamByteReader, everyEOF EveryEOF) *NestedByteReader {
+    contents := []content{{child: r}}
+    if everyEOF != nil {
+        contents = append(contents, content{child: &eofHook{hook: everyEOF}})
+    }
+    return &NestedByteReader{Name: name, contents: contents}
+}
+
+// newPseudoFileStream returns a StreamByteReader for bs read as a pseudo-file.
+func newPseudoFileStream(name string, bs []byte, config *LineConfig) *StreamByteReader {
+    p := NewLineStreamByteReader(name, bytes.NewReader(bs), config)
+    p.lines.pseudo = true
+    return p
+}
+
+// NestedByteReaderFromPseudoFile returns a reader for bs as e-TeX's
+// \scantokens reads it: as a file named name, a line at a time, whose lines
+// are ended by config's new-line character, not by line feeds or carriage
+// returns. When it ends, what everyEOF returns is read, if everyEOF is set.
+func NestedByteReaderFromPseudoFile(name string, bs []byte, config *LineConfig, everyEOF EveryEOF) *NestedByteReader {
+    return withEveryEOF(name, newPseudoFileStream(name, bs, config), everyEOF)
+}
@@ -0,0 +1,93 @@
+package read
+
+import (
+    "testing"
+)
+
+func TestPseudoFile(t *testing.T) {
+    tests := []struct {
+        name string
+        input string
+        newLineChar int
+        everyEOF string
+        want string
+        // lineNrs are the line numbers of the characters read from the
+        // pseudo-file.
+        lineNrs []int
+    }{
+        {"one line", "ab", '|', "", "ab$", []int{0, 0, 0}},
+        {"lines", "ab|cd", '|', "", "ab$cd$", []int{0, 0, 0, 1, 1, 1}},
+        {"line feeds", "a\nb\rc|d", '|', "", "a\nb\rc$d$", []int{0, 0, 0, 0, 0, 0, 1, 1}},
+        {"no new-line character", "ab|cd", -1, "", "ab|cd$", []int{0, 0, 0, 0, 0, 0}},
+        {"trailing spaces", "a  |b ", '|', "", "a$b$", []int{0, 0, 1, 1}},
+        {"empty lines", "||a", '|', "", "$$a$", []int{0, 1, 2, 2}},
+        {"empty", "", '|', "", "", nil},
+        {"everyeof", "ab", '|', "XY", "ab$XY", []int{0, 0, 0}},
+        {"empty with everyeof", "", '|', "XY", "XY", nil},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            config := &LineConfig{EndLineChar: '$', NewLineChar: test.newLineChar}
+            var everyEOF EveryEOF
+            if test.everyEOF != "" {
+                everyEOF = func() []byte { return []byte(test.everyEOF) }
+            }
+            r := NestedByteReaderFromPseudoFile("pseudo", []byte(test.input), config, everyEOF)
+            fbs := readAllFancyBytes(t, r)
+            var got []byte
+            var lineNrs []int
+            for i, fb := range fbs {
+                got = append(got, fb.B)
+                if i < len(fbs) - len(test.everyEOF) {
+                    lineNrs = append(lineNrs, fb.LineNr)
+                } else if fb.ReaderName != EveryEOFName {
+                    t.Errorf("got %q from %q, want it from %q", fb.B, fb.ReaderName, EveryEOFName)
+                }
+            }
+            if string(got) != test.want {
+                t.Errorf("read %q, want %q", got, test.want)
+            }
+            if len(lineNrs) != len(test.lineNrs) {
+                t.Fatalf("got line numbers %v, want %v", lineNrs, test.lineNrs)
+            }
+            for i := range lineNrs {
+                if lineNrs[i] != test.lineNrs[i] {
+                    t.Fatalf("got line numbers %v, want %v", lineNrs, test.lineNrs)
+                }
+            }
+        })
+    }
+}
+
+func TestPseudoFileEveryEOFLate(t *testing.T) {
+    text := "before"
+    everyEOF := func() []byte { return []byte(text) }
+    config := &LineConfig{EndLineChar: -1, NewLineChar: -1}
+    r := NestedByteReaderFromPseudoFile("pseudo", []byte("a"), config, everyEOF)
+    // What \everyeof holds as the pseudo-file ends is read.
+    text = "after"
+    if got := string(readAllBytes(t, r)); got != "aafter" {
+        t.Errorf("read %q, want \"aafter\"", got)
+    }
+}
+
+func TestScanTokens(t *testing.T) {
+    s := NewInputStack(&LineConfig{EndLineChar: '$', NewLineChar: '|'})
+    s.EveryEOF = func() []byte { return []byte("E") }
+    if err := s.ScanTokens("pseudo", []byte("a|b")); err != nil {
+        t.Fatal(err)
+    }
+    if got := s.Depth(); got != 1 {
+        t.Errorf("got depth %v, want 1", got)
+    }
+    skipBytes(t, s, 3)
+    if got := s.Trace(); got != "l.2 in file pseudo" {
+        t.Errorf("got trace %q", got)
+    }
+    if got := string(readAllBytes(t, s)); got != "$E" {
+        t.Errorf("read %q, want \"$E\"", got)
+    }
+    if got := s.Depth(); got != 0 {
+        t.Errorf("got depth %v at the end, want 0", got)
+    }
+}
@@ -2,10 +2,11 @@ package read
 
 import (
     "fmt"
+    "github.com/eddiejessup/gnex/vfs"
     "io"
-    "io/ioutil"
-    "os"
+    "io/fs"
     "path"
+    "unicode/utf8"
 )
 
 type ValueError struct {
@@ -16,17 +17,47 @@ func (p ValueError) Error() string {
     return p.msg
 }
 
+// ExhaustedError is returned when a reader runs out of contents. When
+// peeking, nRead is the number of characters, bytes or runes, that could be
+// peeked before running out.
 type ExhaustedError struct {
-    bytesRead int
+    nRead int
 }
 
 func (p ExhaustedError) Error() string {
-    return fmt.Sprintf("Exhausted, read %v bytes", p.bytesRead)
+    return fmt.Sprintf("Exhausted, read %v characters", p.nRead)
 }
 
-type NestedChild interface {}
+// NewExhaustedError returns the error a reader returns when it runs out of
+// contents, having peeked nRead characters first if it was peeking.
+func NewExhaustedError(nRead int) ExhaustedError {
+    return ExhaustedError{nRead: nRead}
+}
+
+// NRead returns the number of characters that could be peeked.
+func (p ExhaustedError) NRead() int {
+    return p.nRead
+}
+
+// NestedChild is a reader nested in a NestedByteReader, which is read in its
+// place until it runs out, and then moved past. It may be any
+// FancyByteReader, such as another NestedByteReader, a StreamByteReader or
+// a reader of generated content; the characters read from it keep the
+// positions it gives them. It signals that it has run out with an
+// ExhaustedError, or io.EOF. In rune mode, a child that is not a
+// FancyRuneReader is decoded as UTF-8 from its bytes.
+type NestedChild interface {
+    FancyByteReader
+}
+
+// content is an item of a NestedByteReader's contents: a child, or if child
+// is nil, one of the reader's own bytes.
+type content struct {
+    b byte
+    child NestedChild
+}
 
-type fancyByte struct {
+type FancyByte struct {
     B byte
     ReaderName string
     Position int
@@ -36,56 +67,119 @@ type fancyByte struct {
 
 type FancyByteReader interface {
     io.ByteReader
-    ReadFancyByte() (fancyByte, error)
+    ReadFancyByte() (FancyByte, error)
     PeekByte(n int) (byte, error)
 }
 
+// FancyRune is a Unicode code point decoded from UTF-8 input, with the
+// position of its first byte. Size is the number of bytes it was encoded in.
+type FancyRune struct {
+    R rune
+    Size int
+    ReaderName string
+    Position int
+    LineNr int
+    ColNr int
+}
+
+// FancyRuneReader reads input as UTF-8, a code point at a time, as XeTeX and
+// LuaTeX do, rather than a byte at a time as classic TeX does.
+type FancyRuneReader interface {
+    io.RuneReader
+    ReadFancyRune() (FancyRune, error)
+    PeekRune(n int) (rune, error)
+}
+
 type NestedByteReader struct {
     Name string
-    contents []NestedChild
+    contents []content
     Position int
     LineNr int
     ColNr int
+    // Translation, if set, maps the reader's own bytes to internal codes. In
+    // rune mode it makes each byte one character, in place of decoding
+    // UTF-8. A nested reader without one of its own uses its parent's.
+    Translation *Translation
+    // inherited is the Translation of the reader this one is nested in.
+    inherited *Translation
 }
 
 func NestedByteReaderFromBytes(name string, bs []byte) *NestedByteReader {
-    contents := make([]NestedChild, len(bs), len(bs))
+    contents := make([]content, len(bs), len(bs))
     for i, b := range bs {
-        contents[i] = b
+        contents[i] = content{b: b}
     }
     return &NestedByteReader{Name: name, contents: contents}
 }
 
+// NestedByteReaderFromReader returns a reader whose contents are read lazily
+// from r, by a StreamByteReader nested inside it.
 func NestedByteReaderFromReader(name string, r io.Reader) *NestedByteReader {
-    bs, _ := ioutil.ReadAll(r)
-    return NestedByteReaderFromBytes(name, bs)
+    return NestedByteReaderFromChild(name, NewStreamByteReader(name, r))
+}
+
+// NestedByteReaderFromChild returns a reader whose contents are those of
+// child.
+func NestedByteReaderFromChild(name string, child NestedChild) *NestedByteReader {
+    return &NestedByteReader{Name: name, contents: []content{{child: child}}}
 }
 
 func NestedByteReaderFromPath(p string) *NestedByteReader {
-    r, _ := os.Open(p)
+    return NestedByteReaderFromFS(vfs.OS, p)
+}
+
+// NestedByteReaderFromFS returns a reader for the file p in fsys, which is
+// empty if the file cannot be opened.
+func NestedByteReaderFromFS(fsys fs.FS, p string) *NestedByteReader {
     name := path.Base(p)
+    r, err := fsys.Open(p)
+    if err != nil {
+        return NestedByteReaderFromBytes(name, nil)
+    }
     return NestedByteReaderFromReader(name, r)
 }
 
-func (p *NestedByteReader) innerReader() (r NestedChild, err error) {
+func (p *NestedByteReader) innerReader() (c content, err error) {
     if p.Position > len(p.contents) - 1 {
         err = ExhaustedError{}
     } else {
-        r = p.contents[p.Position]
+        c = p.contents[p.Position]
     }
     return
 }
 
-func (p *NestedByteReader) ReadFancyByte() (v fancyByte, err error) {
+// childExhausted returns whether err says that a child has run out.
+func childExhausted(err error) bool {
+    _, ok := err.(ExhaustedError)
+    return ok || err == io.EOF
+}
+
+// peekedBeforeExhausted returns how many of the n characters asked for a
+// child could peek, given the error it returned. A child that returns io.EOF
+// does not say, so it is asked, with peek, for fewer.
+func peekedBeforeExhausted(peek func(n int) error, n int, err error) int {
+    if e, ok := err.(ExhaustedError); ok {
+        return e.nRead
+    }
+    nRead := 0
+    for nRead < n - 1 && peek(nRead + 1) == nil {
+        nRead++
+    }
+    return nRead
+}
+
+func (p *NestedByteReader) ReadFancyByte() (v FancyByte, err error) {
     for {
-        innerR, errR := p.innerReader()
+        inner, errR := p.innerReader()
 
         if err, ok := errR.(ExhaustedError); ok {
-            return fancyByte{}, err
+            return FancyByte{}, err
         }
 
-        if b, ok := innerR.(byte); ok {
-            v = fancyByte{B: b, ReaderName: p.Name, Position: p.Position,
+        if inner.child == nil {
+            b := inner.b
+            c, err := p.ord(b)
+            v = FancyByte{B: c, ReaderName: p.Name, Position: p.Position,
                           LineNr: p.LineNr, ColNr: p.ColNr}
             p.Position++
             if b == '\n' {
@@ -94,26 +188,59 @@ func (p *NestedByteReader) ReadFancyByte() (v fancyByte, err error) {
             } else {
                 p.ColNr++
             }
-            return v, nil
-        } else if nBR, ok := innerR.(NestedByteReader); ok {
-            v, errB := nBR.ReadFancyByte()
-            // If the inner reader returns a value, return that.
-            if errB == nil {
-                return v, errB
-            } else if _, ok := errB.(ExhaustedError); ok {
-                // We must have exhausted the current inner reader.
-                // Move to the next one and try again.
-                p.Position++            
-            } else {
-                // Unknown error, return it.
-                return v, errB
-            }
+            return v, err
+        }
+        v, errB := p.pass(inner.child).ReadFancyByte()
+        // If the inner reader returns a value, return that.
+        if errB == nil {
+            return v, errB
+        } else if childExhausted(errB) {
+            // We must have exhausted the current inner reader.
+            // Move to the next one and try again.
+            p.Position++
         } else {
-            panic(fmt.Sprintf("Unknown inner reader type '%v'", innerR))
+            // Unknown error, return it.
+            return v, errB
         }
     }
 }
 
+// translation returns the Translation the reader's own bytes are read with.
+func (p *NestedByteReader) translation() *Translation {
+    if p.Translation != nil {
+        return p.Translation
+    }
+    return p.inherited
+}
+
+// inheritor is a child that reads with the Translation of the reader it is
+// nested in, unless it has its own.
+type inheritor interface {
+    inheritTranslation(t *Translation)
+}
+
+func (p *NestedByteReader) inheritTranslation(t *Translation) {
+    p.inherited = t
+}
+
+// pass gives a child the reader's Translation to inherit, before it is read
+// from. Children of other types are read as they are.
+func (p *NestedByteReader) pass(c NestedChild) NestedChild {
+    if i, ok := c.(inheritor); ok {
+        i.inheritTranslation(p.translation())
+    }
+    return c
+}
+
+// ord returns the internal code for one of the reader's bytes in byte mode.
+func (p *NestedByteReader) ord(b byte) (byte, error) {
+    t := p.translation()
+    if t == nil {
+        return b, nil
+    }
+    return t.ordByte(b)
+}
+
 func (p *NestedByteReader) ReadByte() (v byte, err error) {
     vF, err := p.ReadFancyByte()
     v = vF.B
@@ -134,56 +261,233 @@ func (p *NestedByteReader) PeekByte(n int) (v byte, err error) {
         // error containing the number of bytes we managed to read.
         if positionTemp > len(p.contents) - 1 {
             nRead := n - nToRead
-            err = ExhaustedError{bytesRead: nRead}
+            err = ExhaustedError{nRead: nRead}
             return
         }
 
-        innerRTemp := p.contents[positionTemp]
+        innerTemp := p.contents[positionTemp]
 
         // If the current item is a single byte, read that, decrease the number
         // of bytes we must read, and increment our position.
-        if vTemp, ok := innerRTemp.(byte); ok {
+        if innerTemp.child == nil {
             nToRead--
             // If we have peeked all the bytes we have to do, return the peeked value.
             if nToRead == 0 {
-                return vTemp, nil
+                return p.ord(innerTemp.b)
             }
             positionTemp++
-        // If the current item is a nested byte reader.
-        } else if r, ok := innerRTemp.(*NestedByteReader); ok {
-            // Try to peek the number of bytes we have yet to read from that
-            // reader.
-            vTemp, errB := r.PeekByte(nToRead)
-            // If we peek the full number of bytes from it, we are done.
-            if errB == nil {
-                return vTemp, nil
-            // Otherwise, decrease the number of bytes by the number we *did*
-            // manage to peek, and increment our position.
-            } else if e, ok := errB.(ExhaustedError); ok {
-                // Given that we returned an exhausted error, we should have
-                // read fewer bytes than we requested.
-                if e.bytesRead >= nToRead {
-                    panic(fmt.Sprintf("Peeking %v bytes returned an error, but also read %v bytes", nToRead, e.bytesRead))
-                }
-                nToRead -= e.bytesRead
-                positionTemp++
-            // If we got some other error, just return that.
-            } else {
-                return vTemp, errB
+            continue
+        }
+        // If the current item is a nested reader, try to peek the number of
+        // bytes we have yet to read from that reader.
+        r := p.pass(innerTemp.child)
+        vTemp, errB := r.PeekByte(nToRead)
+        // If we peek the full number of bytes from it, we are done.
+        if errB == nil {
+            return vTemp, nil
+        // Otherwise, decrease the number of bytes by the number we *did*
+        // manage to peek, and increment our position.
+        } else if childExhausted(errB) {
+            nRead := peekedBeforeExhausted(func(n int) error {
+                _, err := r.PeekByte(n)
+                return err
+            }, nToRead, errB)
+            // Given that we returned an exhausted error, we should have
+            // read fewer bytes than we requested.
+            if nRead >= nToRead {
+                panic(fmt.Sprintf("Peeking %v bytes returned an error, but also read %v bytes", nToRead, nRead))
             }
+            nToRead -= nRead
+            positionTemp++
+        // If we got some other error, just return that.
         } else {
-            panic(fmt.Sprintf("Unknown inner reader '%v'", innerRTemp))
+            return vTemp, errB
         }
     }
 }
 
-
+// Insert nests r in the reader, to be read before the rest of its contents.
+// If the reader is reading a NestedByteReader, r is inserted into that
+// instead.
 func (p *NestedByteReader) Insert(r NestedChild) {
-    innerR, _ := p.innerReader()
-    if v, ok := innerR.(*NestedByteReader); ok {
-        v.Insert(r)                
+    inner, _ := p.innerReader()
+    if v, ok := inner.child.(*NestedByteReader); ok {
+        v.Insert(r)
     } else {
+        // Build new contents, rather than inserting in place, so that marks
+        // keep the contents they saved.
         i := p.Position
-        p.contents = append(p.contents[:i], append([]NestedChild{r}, p.contents[i:]...)...)        
+        if i > len(p.contents) {
+            i = len(p.contents)
+        }
+        contents := make([]content, 0, len(p.contents) + 1)
+        contents = append(contents, p.contents[:i]...)
+        contents = append(contents, content{child: r})
+        p.contents = append(contents, p.contents[i:]...)
+    }
+}
+
+// decodeRuneAt decodes the UTF-8 sequence starting at a position in the
+// reader's own contents, or translates the byte there if the reader has a
+// Translation. A sequence never continues into a nested reader. An invalid
+// sequence decodes to utf8.RuneError with size 1, so that a stray byte is
+// skipped on its own.
+func (p *NestedByteReader) decodeRuneAt(position int) (r rune, size int) {
+    if t := p.translation(); t != nil {
+        return t.Ord(p.contents[position].b), 1
+    }
+    var bs []byte
+    for i := position; i < len(p.contents) && len(bs) < utf8.UTFMax; i++ {
+        if p.contents[i].child != nil {
+            break
+        }
+        bs = append(bs, p.contents[i].b)
+    }
+    return utf8.DecodeRune(bs)
+}
+
+// ReadFancyRune reads the next code point, decoding UTF-8. Column numbers
+// count code points, so a reader should be read either by rune or by byte
+// throughout, not a mixture of the two.
+func (p *NestedByteReader) ReadFancyRune() (v FancyRune, err error) {
+    for {
+        inner, errR := p.innerReader()
+
+        if err, ok := errR.(ExhaustedError); ok {
+            return FancyRune{}, err
+        }
+
+        if inner.child == nil {
+            r, size := p.decodeRuneAt(p.Position)
+            v = FancyRune{R: r, Size: size, ReaderName: p.Name, Position: p.Position,
+                          LineNr: p.LineNr, ColNr: p.ColNr}
+            p.Position += size
+            if r == '\n' {
+                p.LineNr++
+                p.ColNr = 0
+            } else {
+                p.ColNr++
+            }
+            return v, nil
+        }
+        v, errB := readChildRune(p.pass(inner.child))
+        if errB == nil {
+            return v, errB
+        } else if childExhausted(errB) {
+            p.Position++
+        } else {
+            return v, errB
+        }
+    }
+}
+
+func (p *NestedByteReader) ReadRune() (v rune, size int, err error) {
+    vF, err := p.ReadFancyRune()
+    return vF.R, vF.Size, err
+}
+
+// PeekRune returns the nth code point ahead, as PeekByte does for bytes.
+func (p *NestedByteReader) PeekRune(n int) (v rune, err error) {
+    if n < 1 {
+        err = ValueError{msg: fmt.Sprintf("Cannot peek %#v runes, backwards peeking not implemented", n)}
+        return
+    }
+
+    nToRead := n
+    positionTemp := p.Position
+
+    for {
+        if positionTemp > len(p.contents) - 1 {
+            err = ExhaustedError{nRead: n - nToRead}
+            return
+        }
+
+        innerTemp := p.contents[positionTemp]
+
+        if innerTemp.child == nil {
+            vTemp, size := p.decodeRuneAt(positionTemp)
+            nToRead--
+            if nToRead == 0 {
+                return vTemp, nil
+            }
+            positionTemp += size
+            continue
+        }
+        r := p.pass(innerTemp.child)
+        vTemp, errB := peekChildRune(r, nToRead)
+        if errB == nil {
+            return vTemp, nil
+        } else if childExhausted(errB) {
+            nToRead -= peekedBeforeExhausted(func(n int) error {
+                _, err := peekChildRune(r, n)
+                return err
+            }, nToRead, errB)
+            positionTemp++
+        } else {
+            return vTemp, errB
+        }
+    }
+}
+
+// readChildRune reads a code point from a child, decoding it from the
+// child's bytes if the child cannot read code points itself.
+func readChildRune(c NestedChild) (v FancyRune, err error) {
+    if r, ok := c.(FancyRuneReader); ok {
+        return r.ReadFancyRune()
+    }
+    var bs []byte
+    for len(bs) < utf8.UTFMax && !utf8.FullRune(bs) {
+        b, err := c.PeekByte(len(bs) + 1)
+        if err != nil {
+            if len(bs) == 0 {
+                return FancyRune{}, err
+            }
+            break
+        }
+        bs = append(bs, b)
+    }
+    r, size := utf8.DecodeRune(bs)
+    first, err := c.ReadFancyByte()
+    if err != nil {
+        return FancyRune{}, err
+    }
+    for i := 1; i < size; i++ {
+        if _, err := c.ReadFancyByte(); err != nil {
+            return FancyRune{}, err
+        }
+    }
+    return FancyRune{R: r, Size: size, ReaderName: first.ReaderName, Position: first.Position,
+                     LineNr: first.LineNr, ColNr: first.ColNr}, nil
+}
+
+// peekChildRune returns the nth code point ahead in a child, as
+// readChildRune decodes them, or an ExhaustedError with the number of code
+// points it could peek.
+func peekChildRune(c NestedChild, n int) (rune, error) {
+    if r, ok := c.(FancyRuneReader); ok {
+        return r.PeekRune(n)
+    }
+    nRead, offset := 0, 0
+    for {
+        var bs []byte
+        for len(bs) < utf8.UTFMax && !utf8.FullRune(bs) {
+            b, err := c.PeekByte(offset + len(bs) + 1)
+            if err != nil {
+                if !childExhausted(err) {
+                    return 0, err
+                }
+                break
+            }
+            bs = append(bs, b)
+        }
+        if len(bs) == 0 {
+            return 0, ExhaustedError{nRead: nRead}
+        }
+        r, size := utf8.DecodeRune(bs)
+        nRead++
+        if nRead == n {
+            return r, nil
+        }
+        offset += size
     }
 }
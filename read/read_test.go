@@ -0,0 +1,84 @@
+package read
+
+import (
+    "strings"
+    "testing"
+)
+
+// countReader is a FancyByteReader of generated content: the bytes '0' to
+// '0'+n-1, positioned as if on one line of a reader called "count".
+type countReader struct {
+    n int
+    pos int
+}
+
+func (c *countReader) ReadFancyByte() (FancyByte, error) {
+    if c.pos >= c.n {
+        return FancyByte{}, NewExhaustedError(0)
+    }
+    v := FancyByte{B: byte('0' + c.pos), ReaderName: "count", Position: c.pos, ColNr: c.pos}
+    c.pos++
+    return v, nil
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+    v, err := c.ReadFancyByte()
+    return v.B, err
+}
+
+func (c *countReader) PeekByte(n int) (byte, error) {
+    if c.pos + n > c.n {
+        return 0, NewExhaustedError(c.n - c.pos)
+    }
+    return byte('0' + c.pos + n - 1), nil
+}
+
+func TestInsertedChildren(t *testing.T) {
+    tests := []struct {
+        name string
+        child NestedChild
+        want string
+        // wantName is the reader name that the second byte read is given.
+        wantName string
+    }{
+        {"nested reader", NestedByteReaderFromBytes("child", []byte("XY")), "aXYb", "child"},
+        {"stream", NewStreamByteReader("child", strings.NewReader("")), "ab", "test"},
+        {"generated", &countReader{n: 3}, "a012b", "count"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            newReader := func() *NestedByteReader {
+                r := NestedByteReaderFromBytes("test", []byte("ab"))
+                if _, err := r.ReadByte(); err != nil {
+                    t.Fatal(err)
+                }
+                r.Insert(test.child)
+                return r
+            }
+            r := newReader()
+            var got []byte
+            for i := 1; ; i++ {
+                v, err := r.PeekByte(i)
+                if err != nil {
+                    break
+                }
+                got = append(got, v)
+            }
+            if string(got) != test.want[1:] {
+                t.Errorf("peeked %q, want %q", got, test.want[1:])
+            }
+
+            fbs := readAllFancyBytes(t, r)
+            got = got[:0]
+            for _, fb := range fbs {
+                got = append(got, fb.B)
+            }
+            if string(got) != test.want[1:] {
+                t.Errorf("read %q, want %q", got, test.want[1:])
+            }
+            if len(fbs) > 0 && fbs[0].ReaderName != test.wantName {
+                t.Errorf("got the first byte from %q, want %q", fbs[0].ReaderName, test.wantName)
+            }
+        })
+    }
+}
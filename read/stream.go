@@ -0,0 +1,350 @@
+package read
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "unicode/utf8"
+)
+
+// DefaultStreamBufferSize is the size of a StreamByteReader's buffer, which
+// bounds how far ahead it can peek.
+const DefaultStreamBufferSize = 4096
+
+// StreamByteReader reads lazily from an io.Reader, holding no more of it in
+// memory than its buffer, so it can read from pipes and inputs too large to
+// hold whole.
+type StreamByteReader struct {
+    Name string
+    r *bufio.Reader
+    source io.Reader
+    // lines is set if the source is read a line at a time, in which case
+    // it, not line feeds, says where lines end.
+    lines *lineReader
+    // limit, if not negative, is a position at which the reader stops as if
+    // its source ended there.
+    limit int
+    // tape holds the bytes read from r while the reader is marked, so that
+    // it can be reset and read them again, from tapePos. marks counts the
+    // marks not yet released.
+    tape []byte
+    tapePos int
+    marks int
+    // closed is set once the source has ended and been closed, after which
+    // it is not read again.
+    closed bool
+    Position int
+    LineNr int
+    ColNr int
+    // Translation, if set, maps bytes to internal codes, as for a
+    // NestedByteReader. Without one, the reader uses that of the reader it
+    // is nested in, unless it reads a pseudo-file, whose bytes are internal
+    // codes already.
+    Translation *Translation
+    inherited *Translation
+}
+
+// NewStreamByteReader returns a StreamByteReader reading from r. If r is an
+// io.Closer, it is closed once it is exhausted.
+func NewStreamByteReader(name string, r io.Reader) *StreamByteReader {
+    return NewStreamByteReaderSize(name, r, DefaultStreamBufferSize)
+}
+
+// NewStreamByteReaderSize returns a StreamByteReader whose buffer holds size
+// bytes.
+func NewStreamByteReaderSize(name string, r io.Reader, size int) *StreamByteReader {
+    return &StreamByteReader{Name: name, r: bufio.NewReaderSize(r, size), source: r, limit: -1}
+}
+
+// close closes the source, which is not read again.
+func (p *StreamByteReader) close() {
+    if c, ok := p.source.(io.Closer); ok && !p.closed {
+        c.Close()
+    }
+    p.closed = true
+}
+
+// readError converts the end of the source into an ExhaustedError. The
+// source is closed once nothing is left of it to read, which is not so if
+// the end was found by peeking past bytes still buffered or taped.
+func (p *StreamByteReader) readError(err error, nRead int) error {
+    if err == io.EOF {
+        if p.r.Buffered() == 0 && p.tapePos >= len(p.tape) {
+            p.close()
+        }
+        return ExhaustedError{nRead: nRead}
+    }
+    if err == bufio.ErrBufferFull {
+        return ValueError{msg: fmt.Sprintf("Cannot peek beyond the %v bytes buffered by %v", p.r.Size(), p.Name)}
+    }
+    if err == errLineHeld {
+        return ValueError{msg: fmt.Sprintf("Cannot peek beyond the line being read from %v", p.Name)}
+    }
+    return err
+}
+
+func (p *StreamByteReader) translation() *Translation {
+    if p.Translation != nil {
+        return p.Translation
+    }
+    return p.inherited
+}
+
+func (p *StreamByteReader) inheritTranslation(t *Translation) {
+    if p.lines == nil || !p.lines.pseudo {
+        p.inherited = t
+    }
+}
+
+func (p *StreamByteReader) ord(b byte) (byte, error) {
+    t := p.translation()
+    if t == nil {
+        return b, nil
+    }
+    return t.ordByte(b)
+}
+
+// syncLines moves to a new line if the lines read so far end at the reader's
+// position, which it checks once it has read on and knows the next character
+// exists. Several lines can end there at once, if they are empty and have no
+// end-of-line character.
+func (p *StreamByteReader) syncLines() {
+    if p.lines == nil {
+        return
+    }
+    if n := p.lines.passed(p.Position); n > 0 {
+        p.LineNr += n
+        p.ColNr = 0
+    }
+}
+
+// advance moves past a character that began with the byte b, and was size
+// bytes long.
+func (p *StreamByteReader) advance(b byte, size int) {
+    p.Position += size
+    if p.lines == nil && b == '\n' {
+        p.LineNr++
+        p.ColNr = 0
+    } else {
+        p.ColNr++
+    }
+}
+
+// available returns how many bytes can be read before the limit, if there is
+// one.
+func (p *StreamByteReader) available() (n int, limited bool) {
+    if p.limit < 0 {
+        return 0, false
+    }
+    return p.limit - p.Position, true
+}
+
+// atLimit returns whether the reader has stopped at its limit, in which case
+// it is done with its source, and closes it.
+func (p *StreamByteReader) atLimit() bool {
+    if n, limited := p.available(); !limited || n > 0 {
+        return false
+    }
+    p.close()
+    return true
+}
+
+// endAfterLine makes the reader stop at the end of the line it is reading,
+// as \endinput does, or at once if it has read none of the line. Only a
+// reader that reads a line at a time knows where its lines end; any other
+// stops at once.
+func (p *StreamByteReader) endAfterLine() {
+    p.limit = p.Position
+    if p.lines == nil || p.ColNr == 0 {
+        return
+    }
+    if end, ok := p.lines.nextEnd(); ok {
+        p.limit = end
+    }
+}
+
+// next reads the next byte, from the tape if the reader has been reset, and
+// records it if the reader is marked.
+func (p *StreamByteReader) next() (byte, error) {
+    if p.tapePos < len(p.tape) {
+        b := p.tape[p.tapePos]
+        p.tapePos++
+        return b, nil
+    }
+    if p.marks == 0 {
+        p.tape, p.tapePos = nil, 0
+    }
+    if p.closed {
+        return 0, io.EOF
+    }
+    b, err := p.r.ReadByte()
+    if err != nil {
+        return 0, err
+    }
+    if p.marks > 0 {
+        p.tape = append(p.tape, b)
+        p.tapePos++
+    }
+    return b, nil
+}
+
+// peek returns the next n bytes without reading them, as bufio.Reader's Peek
+// does. If the source is read a line at a time, a line is only read by
+// peeking if nothing is left of the one before it.
+func (p *StreamByteReader) peek(n int) ([]byte, error) {
+    taped := p.tape[p.tapePos:]
+    if n <= len(taped) {
+        return taped[:n], nil
+    }
+    if p.closed {
+        return taped, io.EOF
+    }
+    if p.lines != nil {
+        p.lines.peeking = true
+        p.lines.held = len(taped) > 0 || p.r.Buffered() > 0
+        defer func() { p.lines.peeking = false }()
+    }
+    if len(taped) == 0 {
+        return p.r.Peek(n)
+    }
+    more, err := p.r.Peek(n - len(taped))
+    return append(append([]byte(nil), taped...), more...), err
+}
+
+// discard reads n bytes, which must be available.
+func (p *StreamByteReader) discard(n int) error {
+    for i := 0; i < n; i++ {
+        if _, err := p.next(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (p *StreamByteReader) ReadFancyByte() (v FancyByte, err error) {
+    if p.atLimit() {
+        return FancyByte{}, ExhaustedError{}
+    }
+    b, err := p.next()
+    if err != nil {
+        return FancyByte{}, p.readError(err, 0)
+    }
+    p.syncLines()
+    c, err := p.ord(b)
+    v = FancyByte{B: c, ReaderName: p.Name, Position: p.Position,
+                  LineNr: p.LineNr, ColNr: p.ColNr}
+    p.advance(b, 1)
+    return v, err
+}
+
+func (p *StreamByteReader) ReadByte() (v byte, err error) {
+    vF, err := p.ReadFancyByte()
+    v = vF.B
+    return
+}
+
+// PeekByte returns the nth byte ahead. n may be at most the size of the
+// buffer.
+func (p *StreamByteReader) PeekByte(n int) (v byte, err error) {
+    if n < 1 {
+        err = ValueError{msg: fmt.Sprintf("Cannot peek %#v bytes, backwards peeking not implemented", n)}
+        return
+    }
+    if avail, limited := p.available(); limited && n > avail {
+        return 0, ExhaustedError{nRead: avail}
+    }
+    bs, err := p.peek(n)
+    if err != nil {
+        return 0, p.readError(err, len(bs))
+    }
+    return p.ord(bs[n-1])
+}
+
+// decodeRune decodes the character at the start of bs, as a
+// NestedByteReader's decodeRuneAt does.
+func (p *StreamByteReader) decodeRune(bs []byte) (r rune, size int) {
+    if t := p.translation(); t != nil {
+        return t.Ord(bs[0]), 1
+    }
+    return utf8.DecodeRune(bs)
+}
+
+// peekUpTo peeks as many bytes as are available, up to n or the size of the
+// buffer, without treating the end of the source, or of a line not yet
+// consumed, as an error. eof is whether the bytes run to the end of the
+// source, or to the limit, and held whether they run to the end of the line.
+func (p *StreamByteReader) peekUpTo(n int) (bs []byte, eof, held bool, err error) {
+    if avail, limited := p.available(); limited && n >= avail && avail <= p.r.Size() {
+        bs, err = p.peek(avail)
+        if err == errLineHeld {
+            return bs, false, true, nil
+        }
+        return bs, true, false, err
+    }
+    if n > p.r.Size() {
+        n = p.r.Size()
+    }
+    bs, err = p.peek(n)
+    if err == io.EOF {
+        return bs, true, false, nil
+    } else if err == errLineHeld {
+        return bs, false, true, nil
+    }
+    return
+}
+
+func (p *StreamByteReader) ReadFancyRune() (v FancyRune, err error) {
+    if p.atLimit() {
+        return FancyRune{}, ExhaustedError{}
+    }
+    bs, _, _, err := p.peekUpTo(utf8.UTFMax)
+    if err != nil {
+        return FancyRune{}, p.readError(err, 0)
+    }
+    if len(bs) == 0 {
+        return FancyRune{}, p.readError(io.EOF, 0)
+    }
+    r, size := p.decodeRune(bs)
+    first := bs[0]
+    p.syncLines()
+    v = FancyRune{R: r, Size: size, ReaderName: p.Name, Position: p.Position,
+                  LineNr: p.LineNr, ColNr: p.ColNr}
+    if err = p.discard(size); err != nil {
+        return FancyRune{}, err
+    }
+    p.advance(first, size)
+    return v, nil
+}
+
+func (p *StreamByteReader) ReadRune() (v rune, size int, err error) {
+    vF, err := p.ReadFancyRune()
+    return vF.R, vF.Size, err
+}
+
+// PeekRune returns the nth character ahead. The characters up to it must fit
+// in the buffer.
+func (p *StreamByteReader) PeekRune(n int) (v rune, err error) {
+    if n < 1 {
+        err = ValueError{msg: fmt.Sprintf("Cannot peek %#v runes, backwards peeking not implemented", n)}
+        return
+    }
+    bs, eof, held, err := p.peekUpTo(n * utf8.UTFMax)
+    if err != nil {
+        return 0, p.readError(err, 0)
+    }
+    nRead := 0
+    for len(bs) > 0 {
+        r, size := p.decodeRune(bs)
+        nRead++
+        if nRead == n {
+            return r, nil
+        }
+        bs = bs[size:]
+    }
+    if held {
+        return 0, p.readError(errLineHeld, nRead)
+    } else if !eof {
+        return 0, p.readError(bufio.ErrBufferFull, nRead)
+    }
+    return 0, ExhaustedError{nRead: nRead}
+}
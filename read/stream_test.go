@@ -0,0 +1,196 @@
+package read
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestStreamPeekPastEnd(t *testing.T) {
+    tests := []struct {
+        name string
+        reader func() FancyByteReader
+        // skip is how many bytes are read before peeking peek bytes ahead.
+        skip, peek int
+        want string
+    }{
+        {"stream reader", func() FancyByteReader {
+            return NewStreamByteReader("test", strings.NewReader("ab"))
+        }, 0, 3, "ab"},
+        {"nested stream", func() FancyByteReader {
+            return NestedByteReaderFromReader("test", strings.NewReader("ab"))
+        }, 0, 3, "ab"},
+        {"lines", func() FancyByteReader {
+            return NestedByteReaderFromLines("test", strings.NewReader("ab\ncd"), &LineConfig{EndLineChar: '|'})
+        }, 3, 4, "cd|"},
+        {"inserted stream", func() FancyByteReader {
+            r := NestedByteReaderFromBytes("test", []byte("xy"))
+            r.Insert(NewStreamByteReader("child", strings.NewReader("ab")))
+            return r
+        }, 0, 5, "abxy"},
+        {"tape", func() FancyByteReader {
+            r := NestedByteReaderFromReader("test", strings.NewReader("abc"))
+            m := r.Mark()
+            r.ReadByte()
+            r.Reset(m)
+            return r
+        }, 0, 4, "abc"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            r := test.reader()
+            skipBytes(t, r, test.skip)
+            _, err := r.PeekByte(test.peek)
+            if e, ok := err.(ExhaustedError); !ok || e.NRead() != len(test.want) {
+                t.Errorf("peeking %v bytes: got %v, want exhausted after %v", test.peek, err, len(test.want))
+            }
+            if got := string(readAllBytes(t, r)); got != test.want {
+                t.Errorf("read %q after peeking, want %q", got, test.want)
+            }
+
+            r = test.reader()
+            skipBytes(t, r, test.skip)
+            if rr, ok := r.(FancyRuneReader); ok {
+                rr.PeekRune(test.peek)
+                if got := string(readAllRunes(t, rr)); got != test.want {
+                    t.Errorf("read %q after peeking runes, want %q", got, test.want)
+                }
+            }
+        })
+    }
+}
+
+// closeCounter is a source that counts the times it is closed.
+type closeCounter struct {
+    *strings.Reader
+    closed int
+}
+
+func (c *closeCounter) Close() error {
+    c.closed++
+    return nil
+}
+
+func TestStreamClosesAtEnd(t *testing.T) {
+    src := &closeCounter{Reader: strings.NewReader("ab")}
+    r := NewStreamByteReader("test", src)
+    r.PeekByte(3)
+    if src.closed != 0 {
+        t.Errorf("closed after peeking past the end, with bytes left to read")
+    }
+    readAllBytes(t, r)
+    if src.closed != 1 {
+        t.Errorf("closed %v times after reading to the end, want once", src.closed)
+    }
+}
+
+type peekReader interface {
+    FancyByteReader
+    FancyRuneReader
+}
+
+func TestStreamPeek(t *testing.T) {
+    tests := []struct {
+        name string
+        reader func() peekReader
+        // skip is how many bytes are read before peeking.
+        skip int
+        // want is what can be peeked, after which peeking finds the end if
+        // exhausted is set, and the end of a line not yet consumed if not.
+        want string
+        exhausted bool
+    }{
+        {"stream", func() peekReader {
+            return NestedByteReaderFromReader("test", strings.NewReader("aé€"))
+        }, 0, "aé€", true},
+        {"empty stream", func() peekReader {
+            return NestedByteReaderFromReader("test", strings.NewReader(""))
+        }, 0, "", true},
+        {"inserted streams", func() peekReader {
+            r := NestedByteReaderFromBytes("test", []byte("xy"))
+            r.ReadByte()
+            r.Insert(NewStreamByteReader("b", strings.NewReader("é")))
+            r.Insert(NewStreamByteReader("a", strings.NewReader("")))
+            r.Insert(NewStreamByteReader("a", strings.NewReader("ab")))
+            return r
+        }, 0, "abéy", true},
+        {"stream in nested reader", func() peekReader {
+            inner := NestedByteReaderFromReader("inner", strings.NewReader("ab"))
+            r := NestedByteReaderFromBytes("test", []byte("xy"))
+            r.Insert(inner)
+            return r
+        }, 1, "bxy", true},
+        {"last line", func() peekReader {
+            return NestedByteReaderFromLines("test", strings.NewReader("ab\ncd"), &LineConfig{EndLineChar: '|'})
+        }, 3, "cd|", true},
+        {"line held", func() peekReader {
+            return NestedByteReaderFromLines("test", strings.NewReader("ab\ncd"), &LineConfig{EndLineChar: '|'})
+        }, 1, "b|", false},
+        {"end input", func() peekReader {
+            s := NewInputStack(&LineConfig{EndLineChar: '|'})
+            s.Push("a.tex", strings.NewReader("one\ntwo"))
+            s.ReadByte()
+            s.EndInput()
+            return s
+        }, 0, "ne|", true},
+        {"end input at end of line", func() peekReader {
+            s := NewInputStack(&LineConfig{EndLineChar: '|'})
+            s.Push("a.tex", strings.NewReader("one\ntwo"))
+            skipBytes(t, s, 4)
+            s.EndInput()
+            return s
+        }, 0, "", true},
+        {"end input in inner file", func() peekReader {
+            s := NewInputStack(&LineConfig{EndLineChar: '|'})
+            s.Push("a.tex", strings.NewReader("one\ntwo"))
+            s.ReadByte()
+            s.Push("b.tex", strings.NewReader("bé\nc"))
+            s.ReadByte()
+            s.EndInput()
+            return s
+        }, 0, "é|ne|", false},
+    }
+    checkEnd := func(t *testing.T, what string, err error, nRead int, exhausted bool) {
+        t.Helper()
+        if exhausted {
+            if e, ok := err.(ExhaustedError); !ok || e.NRead() != nRead {
+                t.Errorf("peeking %v past the end: got %v, want exhausted after %v", what, err, nRead)
+            }
+        } else if _, ok := err.(ValueError); !ok {
+            t.Errorf("peeking %v past the line: got %v, want a ValueError", what, err)
+        }
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            r := test.reader()
+            skipBytes(t, r, test.skip)
+            bs := []byte(test.want)
+            for i := 1; i <= len(bs); i++ {
+                if v, err := r.PeekByte(i); err != nil || v != bs[i-1] {
+                    t.Errorf("peeking byte %v: got %q, %v, want %q", i, v, err, bs[i-1])
+                }
+            }
+            _, err := r.PeekByte(len(bs) + 1)
+            checkEnd(t, "bytes", err, len(bs), test.exhausted)
+            rs := []rune(test.want)
+            for i := 1; i <= len(rs); i++ {
+                if v, err := r.PeekRune(i); err != nil || v != rs[i-1] {
+                    t.Errorf("peeking rune %v: got %q, %v, want %q", i, v, err, rs[i-1])
+                }
+            }
+            _, err = r.PeekRune(len(rs) + 1)
+            checkEnd(t, "runes", err, len(rs), test.exhausted)
+
+            var got []rune
+            for range rs {
+                c, _, err := r.ReadRune()
+                if err != nil {
+                    t.Fatal(err)
+                }
+                got = append(got, c)
+            }
+            if string(got) != test.want {
+                t.Errorf("read %q after peeking, want %q", string(got), test.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,239 @@
+package read
+
+import (
+    "bufio"
+    "fmt"
+    "github.com/eddiejessup/gnex/vfs"
+    "io"
+    "io/fs"
+    "path"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+type TCXError struct {
+    msg string
+}
+
+func (p TCXError) Error() string {
+    return p.msg
+}
+
+// Translation maps between the bytes of a file and TeX's internal character
+// codes, as TeX's xord and xchr arrays do, and says which internal codes are
+// printable, as TCX files do. Characters that are not printable are written
+// in ^^ notation.
+type Translation struct {
+    Name string
+    xord [256]rune
+    xchr map[rune]byte
+    printable map[rune]bool
+}
+
+// NewTranslation returns the translation TeX uses when it has no other: every
+// byte is its own code, and only visible ASCII characters and the space are
+// printable.
+func NewTranslation(name string) *Translation {
+    t := &Translation{Name: name, xchr: make(map[rune]byte), printable: make(map[rune]bool)}
+    for i := 0; i < 256; i++ {
+        t.xord[i] = rune(i)
+        t.xchr[rune(i)] = byte(i)
+    }
+    for c := rune(' '); c <= '~'; c++ {
+        t.printable[c] = true
+    }
+    return t
+}
+
+// Map makes the byte external read as the internal code internal, and the
+// internal code written as the byte. The code the byte was read as before is
+// no longer written as it, but as another byte read as it, if there is one.
+func (t *Translation) Map(external byte, internal rune) {
+    old := t.xord[external]
+    t.xord[external] = internal
+    t.xchr[internal] = external
+    if b, ok := t.xchr[old]; !ok || b != external || old == internal {
+        return
+    }
+    delete(t.xchr, old)
+    for i := 0; i < 256; i++ {
+        if t.xord[i] == old {
+            t.xchr[old] = byte(i)
+            break
+        }
+    }
+}
+
+// SetPrintable sets whether an internal code is written as itself, rather
+// than in ^^ notation.
+func (t *Translation) SetPrintable(internal rune, printable bool) {
+    t.printable[internal] = printable
+}
+
+// Ord returns the internal code for a byte read from a file.
+func (t *Translation) Ord(b byte) rune {
+    return t.xord[b]
+}
+
+// ordByte returns the internal code for a byte as a byte, for reading in byte
+// mode. A byte whose internal code does not fit in a byte, as with CP1252,
+// can only be read in rune mode.
+func (t *Translation) ordByte(b byte) (byte, error) {
+    if c := t.xord[b]; c < 256 {
+        return byte(c), nil
+    }
+    return b, ValueError{msg: fmt.Sprintf("Byte %#x translates to %#U under %v, which can only be read in rune mode", b, t.xord[b], t.Name)}
+}
+
+// Chr returns the byte written for an internal code, if there is one.
+func (t *Translation) Chr(c rune) (b byte, ok bool) {
+    b, ok = t.xchr[c]
+    return
+}
+
+// IsPrintable returns whether an internal code is written as itself.
+func (t *Translation) IsPrintable(c rune) bool {
+    if !t.printable[c] {
+        return false
+    }
+    _, ok := t.xchr[c]
+    return ok
+}
+
+// AppendPrint appends the bytes that TeX writes for an internal code: its
+// byte if it is printable, and otherwise ^^ notation, which for codes beyond
+// 255 is XeTeX's ^^^^ or ^^^^^^ form.
+func (t *Translation) AppendPrint(dst []byte, c rune) []byte {
+    if t.IsPrintable(c) {
+        return append(dst, t.xchr[c])
+    }
+    switch {
+    case c < 64:
+        return append(dst, '^', '^', byte(c+64))
+    case c < 128:
+        return append(dst, '^', '^', byte(c-64))
+    case c < 256:
+        return append(dst, fmt.Sprintf("^^%02x", c)...)
+    case c < 0x10000:
+        return append(dst, fmt.Sprintf("^^^^%04x", c)...)
+    }
+    return append(dst, fmt.Sprintf("^^^^^^%06x", c)...)
+}
+
+// WriteString writes s, taken as a sequence of internal codes, as TeX would
+// print it.
+func (t *Translation) WriteString(w io.Writer, s string) (n int, err error) {
+    var bs []byte
+    for _, c := range s {
+        bs = t.AppendPrint(bs, c)
+    }
+    return w.Write(bs)
+}
+
+// Latin1 returns a translation for ISO-8859-1 files: every byte is its own
+// code, and the visible characters of both halves are printable.
+func Latin1() *Translation {
+    t := NewTranslation("latin1")
+    for c := rune(0xa0); c <= 0xff; c++ {
+        t.printable[c] = true
+    }
+    return t
+}
+
+// cp1252High holds the code points of Windows-1252's bytes 0x80 to 0x9f, with
+// zero for the bytes that are not assigned.
+var cp1252High = [32]rune{
+    0x20ac, 0, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021,
+    0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017d, 0,
+    0, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014,
+    0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0, 0x017e, 0x0178,
+}
+
+// CP1252 returns a translation for Windows-1252 files, whose internal codes
+// are Unicode code points. The characters in 0x80 to 0x9f have code points
+// beyond 255, so reading them in byte mode is an error.
+func CP1252() *Translation {
+    t := Latin1()
+    t.Name = "cp1252"
+    for i, c := range cp1252High {
+        if c != 0 {
+            t.Map(byte(0x80+i), c)
+            t.printable[c] = true
+        }
+    }
+    return t
+}
+
+// parseTCXNumber parses a number in a TCX file, which is written as in C:
+// decimal, octal with a leading 0, or hexadecimal with a leading 0x.
+func parseTCXNumber(s string) (int64, error) {
+    return strconv.ParseInt(s, 0, 32)
+}
+
+// LoadTCX reads a translation in the TCX format of Web2C. Each line maps a
+// byte to an internal code and says whether the code is printable, as
+// "external [internal [printable]]": the internal code defaults to the
+// external byte, and printable to 1. Anything after a % is a comment. Lines
+// modify the default translation, so codes the file does not mention keep
+// their defaults.
+func LoadTCX(name string, r io.Reader) (*Translation, error) {
+    t := NewTranslation(name)
+    scanner := bufio.NewScanner(r)
+    lineNr := 0
+    for scanner.Scan() {
+        lineNr++
+        line := scanner.Text()
+        if i := strings.IndexByte(line, '%'); i >= 0 {
+            line = line[:i]
+        }
+        fields := strings.Fields(line)
+        if len(fields) == 0 {
+            continue
+        }
+        if len(fields) > 3 {
+            return nil, TCXError{msg: fmt.Sprintf("%v:%v: Too many fields", name, lineNr)}
+        }
+        var nums []int64
+        for _, f := range fields {
+            n, err := parseTCXNumber(f)
+            if err != nil {
+                return nil, TCXError{msg: fmt.Sprintf("%v:%v: Bad number %q", name, lineNr, f)}
+            }
+            nums = append(nums, n)
+        }
+        external, internal, printable := nums[0], nums[0], int64(1)
+        if len(nums) > 1 {
+            internal = nums[1]
+        }
+        if len(nums) > 2 {
+            printable = nums[2]
+        }
+        if external < 0 || external > 255 {
+            return nil, TCXError{msg: fmt.Sprintf("%v:%v: Byte %v is not between 0 and 255", name, lineNr, external)}
+        }
+        if internal < 0 || internal > utf8.MaxRune {
+            return nil, TCXError{msg: fmt.Sprintf("%v:%v: Code %v is not a valid character", name, lineNr, internal)}
+        }
+        t.Map(byte(external), rune(internal))
+        t.SetPrintable(rune(internal), printable != 0)
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+func LoadTCXFile(p string) (*Translation, error) {
+    return LoadTCXFS(vfs.OS, p)
+}
+
+// LoadTCXFS reads the TCX file p in fsys.
+func LoadTCXFS(fsys fs.FS, p string) (*Translation, error) {
+    f, err := fsys.Open(p)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    return LoadTCX(path.Base(p), f)
+}
@@ -0,0 +1,167 @@
+package read
+
+import (
+    "bytes"
+    "testing"
+)
+
+// testTranslation maps 0x80 to internal code 0x41, 'A'.
+func testTranslation() *Translation {
+    t := NewTranslation("test")
+    t.Map(0x80, 0x41)
+    return t
+}
+
+func readAllBytes(t *testing.T, r FancyByteReader) []byte {
+    var bs []byte
+    for {
+        b, err := r.ReadByte()
+        if _, ok := err.(ExhaustedError); ok {
+            return bs
+        } else if err != nil {
+            t.Fatal(err)
+        }
+        bs = append(bs, b)
+    }
+}
+
+func readAllRunes(t *testing.T, r FancyRuneReader) []rune {
+    var rs []rune
+    for {
+        c, _, err := r.ReadRune()
+        if _, ok := err.(ExhaustedError); ok {
+            return rs
+        } else if err != nil {
+            t.Fatal(err)
+        }
+        rs = append(rs, c)
+    }
+}
+
+func TestTranslationReachesChildren(t *testing.T) {
+    tests := []struct {
+        name string
+        reader func() *NestedByteReader
+    }{
+        {"bytes", func() *NestedByteReader {
+            return NestedByteReaderFromBytes("test", []byte("a\x80"))
+        }},
+        {"reader", func() *NestedByteReader {
+            return NestedByteReaderFromReader("test", bytes.NewReader([]byte("a\x80")))
+        }},
+        {"nested", func() *NestedByteReader {
+            r := NestedByteReaderFromBytes("outer", nil)
+            r.Insert(NestedByteReaderFromReader("test", bytes.NewReader([]byte("a\x80"))))
+            return r
+        }},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            r := test.reader()
+            r.Translation = testTranslation()
+            if v, err := r.PeekByte(2); err != nil || v != 'A' {
+                t.Errorf("peeked %q, %v, want 'A'", v, err)
+            }
+            if got := readAllBytes(t, r); string(got) != "aA" {
+                t.Errorf("read bytes %q, want \"aA\"", got)
+            }
+
+            r = test.reader()
+            r.Translation = testTranslation()
+            if got := readAllRunes(t, r); string(got) != "aA" {
+                t.Errorf("read runes %q, want \"aA\"", string(got))
+            }
+        })
+    }
+}
+
+func TestTranslationOwnOverridesInherited(t *testing.T) {
+    child := NestedByteReaderFromBytes("child", []byte{0x80})
+    child.Translation = NewTranslation("identity")
+    r := NestedByteReaderFromBytes("outer", nil)
+    r.Translation = testTranslation()
+    r.Insert(child)
+    if got := readAllBytes(t, r); string(got) != "\x80" {
+        t.Errorf("read %q, want \"\\x80\"", got)
+    }
+}
+
+func TestInputStackTranslation(t *testing.T) {
+    s := NewInputStack(&LineConfig{EndLineChar: -1})
+    s.SetTranslation(testTranslation())
+    if err := s.Push("file.tex", bytes.NewReader([]byte("\x80"))); err != nil {
+        t.Fatal(err)
+    }
+    if err := s.ScanTokens("pseudo", []byte("\x80")); err != nil {
+        t.Fatal(err)
+    }
+    // A pseudo-file holds internal codes already, so is not translated.
+    if got := readAllBytes(t, s); string(got) != "\x80A" {
+        t.Errorf("read %q, want \"\\x80A\"", got)
+    }
+}
+
+func TestCP1252(t *testing.T) {
+    tests := []struct {
+        name string
+        input []byte
+        runes string
+        bytesOK bool
+    }{
+        {"ascii", []byte("ab"), "ab", true},
+        {"latin-1", []byte{'a', 0xe9}, "aé", true},
+        {"windows", []byte{'a', 0x80}, "a€", false},
+        {"unassigned", []byte{'a', 0x81}, "a\u0081", true},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            r := NestedByteReaderFromReader("test", bytes.NewReader(test.input))
+            r.Translation = CP1252()
+            if got := string(readAllRunes(t, r)); got != test.runes {
+                t.Errorf("read runes %q, want %q", got, test.runes)
+            }
+
+            r = NestedByteReaderFromReader("test", bytes.NewReader(test.input))
+            r.Translation = CP1252()
+            _, errPeek := r.PeekByte(2)
+            r.ReadByte()
+            _, err := r.ReadByte()
+            if (err == nil) != test.bytesOK || (errPeek == nil) != test.bytesOK {
+                t.Errorf("got errors %v and %v reading the second byte", errPeek, err)
+            }
+        })
+    }
+}
+
+func TestTranslationMap(t *testing.T) {
+    tr := NewTranslation("test")
+    tr.Map(0x80, 'A')
+    tr.Map(0x80, 'A')
+    tr.Map(0x81, 'B')
+    tr.Map(0x81, 'C')
+    tests := []struct {
+        c rune
+        b byte
+        ok bool
+    }{
+        {'A', 0x80, true},
+        // 'B' is written as the byte still read as it.
+        {'B', 0x42, true},
+        {'C', 0x81, true},
+        // The codes the bytes were read as before are not written.
+        {0x80, 0, false},
+        {0x81, 0, false},
+        {'D', 'D', true},
+    }
+    for _, test := range tests {
+        if b, ok := tr.Chr(test.c); ok != test.ok || b != test.b {
+            t.Errorf("Chr(%#U): got %#x, %v, want %#x, %v", test.c, b, ok, test.b, test.ok)
+        }
+    }
+    if got := string(tr.AppendPrint(nil, 0x80)); got != "^^80" {
+        t.Errorf("printed 0x80 as %q, want \"^^80\"", got)
+    }
+    if got := tr.Ord(0x81); got != 'C' {
+        t.Errorf("got Ord(0x81) %q, want 'C'", got)
+    }
+}
@@ -0,0 +1,195 @@
+package tfm
+
+import (
+	"fmt"
+	"io"
+)
+
+// Tag says how to interpret the remainder field of a character's info word.
+type Tag uint8
+
+const (
+	// NoTag means the remainder is unused.
+	NoTag Tag = iota
+	// LigTag means the remainder is the start of the character's
+	// ligature/kern program.
+	LigTag
+	// ListTag means the remainder is the next larger character.
+	ListTag
+	// ExtTag means the remainder is an index into the extensible character
+	// table.
+	ExtTag
+)
+
+type charInfo struct {
+	widthIndex  uint8
+	heightIndex uint8
+	depthIndex  uint8
+	italicIndex uint8
+	tag         Tag
+	remainder   uint8
+}
+
+func readCharInfo(r io.Reader) (ci charInfo, err error) {
+	word, err := read4bui(r)
+	if err != nil {
+		return
+	}
+	ci = charInfo{
+		widthIndex:  uint8(word >> 24),
+		heightIndex: uint8(word>>20) & 0xf,
+		depthIndex:  uint8(word>>16) & 0xf,
+		italicIndex: uint8(word>>10) & 0x3f,
+		tag:         Tag(word>>8) & 0x3,
+		remainder:   uint8(word),
+	}
+	return
+}
+
+// charInfo returns the info word for a character, and whether the character
+// exists in the font. A character exists if it lies in the font's range and
+// has a non-zero width index.
+func (tfm *TFM) charInfo(code byte) (ci charInfo, ok bool) {
+	if uint16(code) < tfm.smallestCharCode || uint16(code) > tfm.largestCharCode {
+		return
+	}
+	ci = tfm.charInfos[uint16(code)-tfm.smallestCharCode]
+	ok = ci.widthIndex != 0
+	return
+}
+
+// HasChar returns whether the font contains the character code.
+func (tfm *TFM) HasChar(code byte) bool {
+	_, ok := tfm.charInfo(code)
+	return ok
+}
+
+// CharDimensions returns the width, height, depth and italic correction of a
+// character exactly, as multiples of the design size. ok is false if the
+// character is not in the font, or its info word refers beyond the end of a
+// dimension table.
+func (tfm *TFM) CharDimensions(code byte) (width, height, depth, italic FixWord, ok bool) {
+	ci, ok := tfm.charInfo(code)
+	if !ok {
+		return
+	}
+	if int(ci.widthIndex) >= len(tfm.widths) ||
+		int(ci.heightIndex) >= len(tfm.heights) ||
+		int(ci.depthIndex) >= len(tfm.depths) ||
+		int(ci.italicIndex) >= len(tfm.italics) {
+		return 0, 0, 0, 0, false
+	}
+	width = tfm.widths[ci.widthIndex]
+	height = tfm.heights[ci.heightIndex]
+	depth = tfm.depths[ci.depthIndex]
+	italic = tfm.italics[ci.italicIndex]
+	return
+}
+
+// CharMetrics returns the width, height, depth and italic correction of a
+// character, in points. ok is false as for CharDimensions.
+func (tfm *TFM) CharMetrics(code byte) (width, height, depth, italic float64, ok bool) {
+	w, h, d, i, ok := tfm.CharDimensions(code)
+	designSize := tfm.DesignSize()
+	return w.Float() * designSize, h.Float() * designSize, d.Float() * designSize, i.Float() * designSize, ok
+}
+
+// ScaledCharMetrics returns the width, height, depth and italic correction of
+// a character in scaled points, for the font used at the size of s. ok is
+// false as for CharDimensions.
+func (tfm *TFM) ScaledCharMetrics(code byte, s Scaler) (width, height, depth, italic Scaled, ok bool) {
+	w, h, d, i, ok := tfm.CharDimensions(code)
+	if !ok {
+		return
+	}
+	return s.Scale(w), s.Scale(h), s.Scale(d), s.Scale(i), true
+}
+
+// CycleError is returned when following a font's chain of next-larger
+// characters leads back to a character already visited.
+type CycleError struct {
+	msg string
+}
+
+func (p CycleError) Error() string {
+	return p.msg
+}
+
+type extensibleRecipe struct {
+	top uint8
+	mid uint8
+	bot uint8
+	rep uint8
+}
+
+func readExtensibleRecipe(r io.Reader) (er extensibleRecipe, err error) {
+	word, err := read4bui(r)
+	if err != nil {
+		return
+	}
+	er = extensibleRecipe{
+		top: uint8(word >> 24),
+		mid: uint8(word >> 16),
+		bot: uint8(word >> 8),
+		rep: uint8(word),
+	}
+	return
+}
+
+func (tfm *TFM) readExtensibleRecipes(r io.ReadSeeker) (err error) {
+	if _, err = r.Seek(tfm.tablePointers[ExtensibleCharacter], io.SeekStart); err != nil {
+		return
+	}
+	n := int(tfm.tableLengthsWords[ExtensibleCharacter])
+	tfm.extensibles = make([]extensibleRecipe, n, n)
+	for i := range tfm.extensibles {
+		if tfm.extensibles[i], err = readExtensibleRecipe(r); err != nil {
+			return readError(err, "extensible character table")
+		}
+	}
+	return nil
+}
+
+// NextLarger returns the next larger version of a character, if the
+// character is part of a charlist.
+func (tfm *TFM) NextLarger(code byte) (next byte, ok bool) {
+	ci, ok := tfm.charInfo(code)
+	if !ok || ci.tag != ListTag {
+		return 0, false
+	}
+	return ci.remainder, true
+}
+
+// CharList returns the chain of successively larger versions of a
+// character, starting with the character itself. As in TFtoPL, the chain
+// stops before a next larger character that is not in the font. A malformed
+// font can make the chain loop back on itself, in which case a CycleError is
+// returned.
+func (tfm *TFM) CharList(code byte) (chain []byte, err error) {
+	var seen [256]bool
+	for {
+		if seen[code] {
+			return chain, CycleError{msg: fmt.Sprintf("Charlist starting at %#o cycles back to %#o", chain[0], code)}
+		}
+		seen[code] = true
+		chain = append(chain, code)
+		next, ok := tfm.NextLarger(code)
+		if !ok || !tfm.HasChar(next) {
+			return chain, nil
+		}
+		code = next
+	}
+}
+
+// ExtensibleRecipe returns the pieces from which an extensible character is
+// built: a repeatable middle section rep, and optional top, mid and bottom
+// pieces, which are zero if absent. ok is false if the character is not
+// extensible.
+func (tfm *TFM) ExtensibleRecipe(code byte) (top, mid, bot, rep byte, ok bool) {
+	ci, ok := tfm.charInfo(code)
+	if !ok || ci.tag != ExtTag || int(ci.remainder) >= len(tfm.extensibles) {
+		return 0, 0, 0, 0, false
+	}
+	er := tfm.extensibles[ci.remainder]
+	return er.top, er.mid, er.bot, er.rep, true
+}
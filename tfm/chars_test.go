@@ -0,0 +1,156 @@
+package tfm
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func loadPL(t *testing.T, pl string) *TFM {
+	t.Helper()
+	font, err := ParsePL(strings.NewReader(pl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return font
+}
+
+func TestCharMetrics(t *testing.T) {
+	font := loadPL(t, testPL)
+	tests := []struct {
+		code                         byte
+		width, height, depth, italic float64
+		ok                           bool
+	}{
+		{'A', 5, 7, 0.99999, 0.49999, true},
+		{'B', 10, 0, 0, 0, true},
+		{'Z', 0, 0, 0, 0, false},
+		{'@', 0, 0, 0, 0, false},
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-5 }
+	for _, test := range tests {
+		w, h, d, i, ok := font.CharMetrics(test.code)
+		if ok != test.ok || !near(w, test.width) || !near(h, test.height) || !near(d, test.depth) || !near(i, test.italic) {
+			t.Errorf("%q: got %v %v %v %v %v, want %v %v %v %v %v", test.code,
+				w, h, d, i, ok, test.width, test.height, test.depth, test.italic, test.ok)
+		}
+	}
+
+	// An info word that refers past the end of a table.
+	font.charInfos['B'-'A'].heightIndex = 15
+	if _, _, _, _, ok := font.CharMetrics('B'); ok {
+		t.Error("got metrics for a character whose height index is past the end of the height table")
+	}
+}
+
+func TestCharList(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch func(font *TFM)
+		code  byte
+		chain string
+		cycle bool
+	}{
+		{"chain", nil, 'C', "CA", false},
+		{"no list", nil, 'A', "A", false},
+		{"missing character", nil, 'Z', "Z", false},
+		{"missing successor", func(font *TFM) {
+			font.charInfos['C'-'A'].remainder = 'Z'
+		}, 'C', "C", false},
+		{"successor with no width", func(font *TFM) {
+			font.charInfos['B'-'A'].widthIndex = 0
+			font.charInfos['C'-'A'].remainder = 'B'
+		}, 'C', "C", false},
+		{"cycle to itself", func(font *TFM) {
+			font.charInfos['C'-'A'].remainder = 'C'
+		}, 'C', "C", true},
+		{"cycle", func(font *TFM) {
+			font.charInfos['A'-'A'].tag = ListTag
+			font.charInfos['A'-'A'].remainder = 'C'
+		}, 'C', "CA", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			font := loadPL(t, testPL)
+			if test.patch != nil {
+				test.patch(font)
+			}
+			chain, err := font.CharList(test.code)
+			if string(chain) != test.chain {
+				t.Errorf("got chain %q, want %q", chain, test.chain)
+			}
+			if _, ok := err.(CycleError); ok != test.cycle {
+				t.Errorf("got error %v, want a cycle: %v", err, test.cycle)
+			}
+		})
+	}
+}
+
+func TestExtensibleRecipe(t *testing.T) {
+	font := loadPL(t, testMathPL)
+	// B has only a top piece and the repeated piece, so its middle and bottom
+	// are zero.
+	top, mid, bot, rep, ok := font.ExtensibleRecipe('B')
+	if !ok || top != 'A' || mid != 0 || bot != 0 || rep != 'A' {
+		t.Errorf("got %q %q %q %q %v, want 'A' 0 0 'A' true", top, mid, bot, rep, ok)
+	}
+	if _, _, _, _, ok := font.ExtensibleRecipe('A'); ok {
+		t.Error("got a recipe for a character that is not extensible")
+	}
+	if _, _, _, _, ok := font.ExtensibleRecipe('Z'); ok {
+		t.Error("got a recipe for a character not in the font")
+	}
+
+	// Pieces that are not in the font are returned as they are, and reported
+	// by Validate.
+	font.extensibles[0].mid = 'Z'
+	font.extensibles[0].rep = 'Y'
+	if _, mid, _, rep, ok := font.ExtensibleRecipe('B'); !ok || mid != 'Z' || rep != 'Y' {
+		t.Errorf("got middle %q and repeated %q, %v, want 'Z' and 'Y', true", mid, rep, ok)
+	}
+	var got []string
+	for _, d := range font.Validate() {
+		got = append(got, d.Message)
+	}
+	want := []string{
+		"Character 0102 has nonexistent middle piece 0132",
+		"Character 0102 has nonexistent repeated piece 0131",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got diagnostics %q, want %q", got, want)
+	}
+
+	// A recipe index past the end of the table.
+	font.charInfos['B'-'A'].remainder = 1
+	if _, _, _, _, ok := font.ExtensibleRecipe('B'); ok {
+		t.Error("got a recipe past the end of the extensible character table")
+	}
+}
+
+func TestSkewKern(t *testing.T) {
+	font, err := Load(bytes.NewReader(testTFM(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kern, err := parseFix("-0.025")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		code, skewChar byte
+		want           FixWord
+	}{
+		{'A', 'B', kern},
+		// A ligature is not a skew kern.
+		{'A', 'C', 0},
+		{'A', 'A', 0},
+		{'B', 'A', 0},
+		{'Z', 'A', 0},
+	}
+	for _, test := range tests {
+		if got := font.SkewKern(test.code, test.skewChar); got != test.want {
+			t.Errorf("SkewKern(%q, %q): got %v, want %v", test.code, test.skewChar, got, test.want)
+		}
+	}
+}
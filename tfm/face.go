@@ -0,0 +1,106 @@
+package tfm
+
+import (
+	"fmt"
+)
+
+// Weight is the weight part of a face code.
+type Weight uint8
+
+const (
+	Medium Weight = iota
+	Bold
+	Light
+)
+
+// Slope is the slope part of a face code.
+type Slope uint8
+
+const (
+	Roman Slope = iota
+	Italic
+)
+
+// Expansion is the expansion part of a face code.
+type Expansion uint8
+
+const (
+	Regular Expansion = iota
+	Condensed
+	Extended
+)
+
+var faceWeights = "MBL"
+var faceSlopes = "RI"
+var faceExpansions = "RCE"
+
+// Face is the face byte of a TFM header. Values below 18 encode a weight,
+// slope and expansion, as 2*weight + slope + 6*expansion, in the Xerox
+// convention that TFM inherited; other values have no standard meaning.
+type Face uint8
+
+// NewFace returns the face code for a weight, slope and expansion.
+func NewFace(w Weight, s Slope, e Expansion) Face {
+	return Face(2*uint8(w) + uint8(s) + 6*uint8(e))
+}
+
+// Valid returns whether the face code encodes a weight, slope and expansion.
+func (f Face) Valid() bool {
+	return f < 18
+}
+
+// Weight returns the face's weight. The result is meaningless unless the
+// face is valid, as are those of Slope and Expansion.
+func (f Face) Weight() Weight {
+	return Weight(f % 6 / 2)
+}
+
+// Slope returns the face's slope.
+func (f Face) Slope() Slope {
+	return Slope(f % 2)
+}
+
+// Expansion returns the face's expansion.
+func (f Face) Expansion() Expansion {
+	return Expansion(f / 6)
+}
+
+// String returns the three-letter code of a valid face, such as "BIR" for
+// bold italic regular, or the face's number in octal otherwise.
+func (f Face) String() string {
+	if !f.Valid() {
+		return fmt.Sprintf("%o", uint8(f))
+	}
+	return string([]byte{faceWeights[f.Weight()], faceSlopes[f.Slope()], faceExpansions[f.Expansion()]})
+}
+
+// Checksum returns the font's checksum, which DVI and VF files that use the
+// font record, so that a mismatched TFM file can be detected.
+func (tfm *TFM) Checksum() uint32 {
+	return tfm.checksum
+}
+
+// ChecksumMatches returns whether the font's checksum agrees with one
+// recorded elsewhere, as ChecksumsMatch decides.
+func (tfm *TFM) ChecksumMatches(checksum uint32) bool {
+	return ChecksumsMatch(tfm.checksum, checksum)
+}
+
+// ChecksumsMatch returns whether two checksums agree. As in DVItype, a zero
+// checksum means it was not computed and matches anything.
+func ChecksumsMatch(a, b uint32) bool {
+	return a == 0 || b == 0 || a == b
+}
+
+// SevenBitSafe returns whether the font's header says that no character
+// below 128 leads, by ligatures or charlists, to one of 128 or more. It is
+// false if the header is too short to carry the flag.
+func (tfm *TFM) SevenBitSafe() bool {
+	return tfm.sevenBitSafe
+}
+
+// Face returns the face byte of the header. ok is false if the header is too
+// short to carry one.
+func (tfm *TFM) Face() (f Face, ok bool) {
+	return tfm.face, tfm.headerDataLengthWords >= faceHeaderLength
+}
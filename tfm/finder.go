@@ -0,0 +1,342 @@
+package tfm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/eddiejessup/gnex/vfs"
+)
+
+// NotFoundError is returned when a font cannot be found on the search path.
+type NotFoundError struct {
+	msg string
+}
+
+func (p NotFoundError) Error() string {
+	return p.msg
+}
+
+// FontsEnvVar is the environment variable holding the search path for TFM
+// files, as for kpathsea.
+const FontsEnvVar = "TEXFONTS"
+
+// lsRName is the name of the file that lists the contents of a directory
+// tree, as made by mktexlsr.
+const lsRName = "ls-R"
+
+// FontFinder resolves font names, such as cmr10, to TFM files by searching a
+// list of directories, in the manner of kpathsea:
+//
+//   - A directory ending in // is searched recursively, the directory itself
+//     first and then its subdirectories in lexical order.
+//   - If the directory at the root of an entry, or the nearest directory above
+//     it that does, holds an ls-R file, as the root of a texmf tree does, the
+//     files it lists under the entry are used in place of looking at the
+//     disk. Files it does not list are still looked for on disk, unless the
+//     entry starts with !!.
+//
+// Directories and files are looked for in a file system, which by default is
+// that of the operating system. Paths in it are separated by slashes.
+//
+// Lookups, directory walks and ls-R files are cached, so files added to the
+// search path after they have been looked at are not seen until ClearCache
+// is called. A FontFinder is safe for concurrent use; lookups only wait for
+// each other to read and update the caches, not to walk directories.
+type FontFinder struct {
+	entries []string
+	fsys    fs.FS
+
+	mu        sync.Mutex
+	found     map[string]string
+	trees     map[string]map[string]string
+	databases map[string]map[string][]string
+	// gen counts the calls to ClearCache, so that what was read from the
+	// file system before one is not cached after it.
+	gen int
+}
+
+// NewFontFinder returns a FontFinder that searches dirs in order.
+func NewFontFinder(dirs ...string) *FontFinder {
+	return NewFontFinderFS(vfs.OS, dirs...)
+}
+
+// NewFontFinderFS returns a FontFinder that searches dirs in fsys in order.
+func NewFontFinderFS(fsys fs.FS, dirs ...string) *FontFinder {
+	return &FontFinder{entries: dirs, fsys: fsys}
+}
+
+// NewFontFinderFromEnv returns a FontFinder that searches the directories in
+// the TEXFONTS environment variable, separated as in PATH. An empty element,
+// such as from a leading or trailing separator, stands for defaults, as does
+// an unset or empty variable.
+func NewFontFinderFromEnv(defaults ...string) *FontFinder {
+	return NewFontFinder(ExpandSearchPath(os.Getenv(FontsEnvVar), defaults)...)
+}
+
+// ExpandSearchPath splits a search path, separated as in PATH, into its
+// directories, putting defaults in place of each empty element.
+func ExpandSearchPath(path string, defaults []string) []string {
+	if path == "" {
+		return append([]string(nil), defaults...)
+	}
+	var dirs []string
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			dirs = append(dirs, defaults...)
+		} else {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// Dirs returns the search path entries, in order.
+func (f *FontFinder) Dirs() []string {
+	return append([]string(nil), f.entries...)
+}
+
+// ClearCache forgets everything the FontFinder has learned about the
+// directories it searches.
+func (f *FontFinder) ClearCache() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.found = nil
+	f.trees = nil
+	f.databases = nil
+	f.gen++
+}
+
+// fontFileName returns the file name for a font name, adding the .tfm
+// extension if it has none.
+func fontFileName(name string) string {
+	if path.Ext(name) == "" {
+		return name + ".tfm"
+	}
+	return name
+}
+
+// Find returns the path of the TFM file for the font name. A name that
+// includes a directory is used as a path as it stands.
+func (f *FontFinder) Find(name string) (string, error) {
+	fileName := fontFileName(name)
+	if strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/') {
+		if vfs.IsFile(f.fsys, fileName) {
+			return fileName, nil
+		}
+		return "", NotFoundError{msg: fmt.Sprintf("Font file %v not found", fileName)}
+	}
+
+	f.mu.Lock()
+	path, ok := f.found[fileName]
+	gen := f.gen
+	f.mu.Unlock()
+	if !ok {
+		var err error
+		if path, err = f.search(fileName); err != nil {
+			return "", err
+		}
+		f.mu.Lock()
+		if f.gen == gen {
+			if f.found == nil {
+				f.found = make(map[string]string)
+			}
+			f.found[fileName] = path
+		}
+		f.mu.Unlock()
+	}
+	if path == "" {
+		return "", f.notFound(name)
+	}
+	return path, nil
+}
+
+func (f *FontFinder) notFound(name string) error {
+	return NotFoundError{msg: fmt.Sprintf("Font %v not found in %v", name, strings.Join(f.entries, string(filepath.ListSeparator)))}
+}
+
+// LoadFont finds the TFM file for the font name and loads it.
+func (f *FontFinder) LoadFont(name string) (*TFM, error) {
+	path, err := f.Find(name)
+	if err != nil {
+		return nil, err
+	}
+	return LoadFS(f.fsys, path)
+}
+
+// search looks for a file through the search path entries, returning the
+// empty path if it is not found.
+func (f *FontFinder) search(fileName string) (string, error) {
+	for _, entry := range f.entries {
+		dbOnly := strings.HasPrefix(entry, "!!")
+		entry = strings.TrimPrefix(entry, "!!")
+		recursive := strings.HasSuffix(entry, "//")
+		root := path.Clean(strings.TrimSuffix(entry, "//"))
+
+		db, err := f.database(root)
+		if err != nil {
+			return "", err
+		}
+		if db != nil {
+			for _, dir := range db[fileName] {
+				if dir == root || recursive && strings.HasPrefix(dir, root+"/") {
+					return path.Join(dir, fileName), nil
+				}
+			}
+		}
+		if dbOnly {
+			continue
+		}
+
+		if !recursive {
+			if p := path.Join(root, fileName); vfs.IsFile(f.fsys, p) {
+				return p, nil
+			}
+			continue
+		}
+		tree, err := f.tree(root)
+		if err != nil {
+			return "", err
+		}
+		if p, ok := tree[fileName]; ok {
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// tree returns the files under root, mapped to the first path at which each
+// name appears in the search order.
+func (f *FontFinder) tree(root string) (map[string]string, error) {
+	f.mu.Lock()
+	tree, ok := f.trees[root]
+	gen := f.gen
+	f.mu.Unlock()
+	if ok {
+		return tree, nil
+	}
+	var dirs []string
+	err := fs.WalkDir(f.fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A missing or unreadable directory is searched as if empty.
+			if d == nil || d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// WalkDir visits a directory's files and subdirectories interleaved, so
+	// collect the files of each directory in turn to search each one fully
+	// before its subdirectories.
+	tree = make(map[string]string)
+	for _, dir := range dirs {
+		entries, err := fs.ReadDir(f.fsys, dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if _, ok := tree[e.Name()]; !ok && !e.IsDir() {
+				tree[e.Name()] = path.Join(dir, e.Name())
+			}
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.gen == gen {
+		if f.trees == nil {
+			f.trees = make(map[string]map[string]string)
+		}
+		f.trees[root] = tree
+	}
+	return tree, nil
+}
+
+// database returns the contents of the ls-R file that covers root, as a map
+// from file name to the directories holding a file of that name. The file is
+// looked for in root and then in each directory above it. The map is nil if
+// there is no ls-R file, and lists files outside root too.
+func (f *FontFinder) database(root string) (map[string][]string, error) {
+	for dir := root; ; dir = path.Dir(dir) {
+		db, err := f.lsR(dir)
+		if err != nil || db != nil {
+			return db, err
+		}
+		if parent := path.Dir(dir); parent == dir {
+			return nil, nil
+		}
+	}
+}
+
+// lsR returns the contents of the ls-R file in dir, as database does, or
+// nil if it has none.
+func (f *FontFinder) lsR(dir string) (map[string][]string, error) {
+	f.mu.Lock()
+	db, ok := f.databases[dir]
+	gen := f.gen
+	f.mu.Unlock()
+	if ok {
+		return db, nil
+	}
+	db, err := readLsR(f.fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.gen == gen {
+		if f.databases == nil {
+			f.databases = make(map[string]map[string][]string)
+		}
+		f.databases[dir] = db
+	}
+	return db, nil
+}
+
+// readLsR reads the ls-R file in root in fsys. The file lists directories,
+// as lines ending in a colon and relative to root, each followed by the names
+// in it.
+func readLsR(fsys fs.FS, root string) (map[string][]string, error) {
+	file, err := fsys.Open(path.Join(root, lsRName))
+	// A file system that cannot hold the name, as a MemFS cannot hold an
+	// absolute one, has no such file.
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	db := make(map[string][]string)
+	dir := root
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "%"):
+		case strings.HasSuffix(line, ":"):
+			dir = strings.TrimSuffix(line, ":")
+			if !path.IsAbs(dir) {
+				dir = path.Join(root, dir)
+			}
+		default:
+			db[line] = append(db[line], dir)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
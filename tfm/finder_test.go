@@ -0,0 +1,195 @@
+package tfm
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/eddiejessup/gnex/vfs"
+)
+
+func TestFontFinderFind(t *testing.T) {
+	fsys := vfs.NewMemFS(map[string][]byte{
+		"fonts/cmr10.tfm":                   nil,
+		"fonts/sub/cmr10.tfm":               nil,
+		"fonts/sub/cmbx10.tfm":              nil,
+		"fonts/sub/deeper/cmti10.tfm":       nil,
+		"fonts/a/z/cmsl10.tfm":              nil,
+		"fonts/b/cmsl10.tfm":                nil,
+		"db/ls-R":                           []byte("% ls-R -- generated\n./x:\ncmss10.tfm\n\n./y:\nghost.tfm\n"),
+		"db/x/cmss10.tfm":                   nil,
+		"db/x/unlisted.tfm":                 nil,
+		"texmf/ls-R":                        []byte("./fonts/tfm/public:\ncmtt10.tfm\n\n./fonts/vf:\ncmtt10.tfm\n"),
+		"texmf/fonts/tfm/public/cmtt10.tfm": nil,
+		"texmf/fonts/vf/cmtt10.tfm":         nil,
+	})
+	tests := []struct {
+		name    string
+		entries []string
+		font    string
+		want    string
+	}{
+		{"plain", []string{"fonts"}, "cmr10", "fonts/cmr10.tfm"},
+		{"extension", []string{"fonts"}, "cmr10.tfm", "fonts/cmr10.tfm"},
+		{"not recursive", []string{"fonts"}, "cmbx10", ""},
+		{"recursive", []string{"fonts//"}, "cmbx10", "fonts/sub/cmbx10.tfm"},
+		{"directory first", []string{"fonts//"}, "cmr10", "fonts/cmr10.tfm"},
+		{"deep", []string{"fonts//"}, "cmti10", "fonts/sub/deeper/cmti10.tfm"},
+		{"lexical order", []string{"fonts//"}, "cmsl10", "fonts/a/z/cmsl10.tfm"},
+		{"entry order", []string{"fonts/sub", "fonts"}, "cmr10", "fonts/sub/cmr10.tfm"},
+		{"ls-R", []string{"db//"}, "cmss10", "db/x/cmss10.tfm"},
+		{"ls-R only lists", []string{"db//"}, "ghost", "db/y/ghost.tfm"},
+		{"not in ls-R", []string{"db//"}, "unlisted", "db/x/unlisted.tfm"},
+		{"ls-R only", []string{"!!db//"}, "unlisted", ""},
+		{"ls-R above entry", []string{"!!texmf/fonts/tfm//"}, "cmtt10", "texmf/fonts/tfm/public/cmtt10.tfm"},
+		{"ls-R above, outside entry", []string{"!!texmf/fonts/tfm/public"}, "cmtt10", "texmf/fonts/tfm/public/cmtt10.tfm"},
+		{"ls-R filtered by entry", []string{"!!texmf/fonts/vf/none//"}, "cmtt10", ""},
+		{"missing", []string{"fonts//", "nowhere//"}, "cmu10", ""},
+		{"path", []string{"nowhere"}, "fonts/sub/cmbx10", "fonts/sub/cmbx10.tfm"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewFontFinderFS(fsys, test.entries...).Find(test.font)
+			if test.want == "" {
+				if _, ok := err.(NotFoundError); !ok {
+					t.Errorf("got %q, %v, want a NotFoundError", got, err)
+				}
+				return
+			}
+			if err != nil || got != test.want {
+				t.Errorf("got %q, %v, want %q", got, err, test.want)
+			}
+		})
+	}
+}
+
+func TestFontFinderCache(t *testing.T) {
+	fsys := vfs.NewMemFS(map[string][]byte{"fonts/a/cmr10.tfm": nil})
+	f := NewFontFinderFS(fsys, "fonts//")
+	if _, err := f.Find("cmbx10"); err == nil {
+		t.Fatal("found a missing font")
+	}
+	fsys.WriteFile("fonts/b/cmbx10.tfm", nil)
+	if _, err := f.Find("cmbx10"); err == nil {
+		t.Error("found a font added after the search path was cached")
+	}
+	f.ClearCache()
+	if got, err := f.Find("cmbx10"); err != nil || got != "fonts/b/cmbx10.tfm" {
+		t.Errorf("got %q, %v after clearing the cache", got, err)
+	}
+}
+
+func TestFontFinderOS(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/b", "texmf/fonts/tfm/x"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"a/b/cmr10.tfm":                string(testTFM(t)),
+		"texmf/ls-R":                   "./fonts/tfm/x:\ncmbx10.tfm\n",
+		"texmf/fonts/tfm/x/cmbx10.tfm": "",
+	}
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := NewFontFinder(filepath.Join(root, "a")+"//", "!!"+filepath.Join(root, "texmf", "fonts", "tfm")+"//")
+	font, err := f.LoadFont("cmr10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if font.Family() != "CMR" {
+		t.Errorf("got family %q, want CMR", font.Family())
+	}
+	want := filepath.ToSlash(filepath.Join(root, "texmf", "fonts", "tfm", "x", "cmbx10.tfm"))
+	if got, err := f.Find("cmbx10"); err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestExpandSearchPath(t *testing.T) {
+	sep := string(filepath.ListSeparator)
+	defaults := []string{"d1", "d2"}
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"", []string{"d1", "d2"}},
+		{"x", []string{"x"}},
+		{"x" + sep + "y", []string{"x", "y"}},
+		{sep + "x", []string{"d1", "d2", "x"}},
+		{"x" + sep, []string{"x", "d1", "d2"}},
+	}
+	for _, test := range tests {
+		if got := ExpandSearchPath(test.path, defaults); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+// blockingFS holds up reading the directory dir until release is closed,
+// sending on entered when it starts to.
+type blockingFS struct {
+	*vfs.MemFS
+	dir     string
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == b.dir {
+		select {
+		case b.entered <- struct{}{}:
+		default:
+		}
+		<-b.release
+	}
+	return b.MemFS.ReadDir(name)
+}
+
+func TestFontFinderConcurrentWalk(t *testing.T) {
+	fsys := &blockingFS{
+		MemFS:   vfs.NewMemFS(map[string][]byte{"fast/cmr10.tfm": nil, "slow/cmbx10.tfm": nil}),
+		dir:     "slow",
+		entered: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	f := NewFontFinderFS(fsys, "fast", "slow//")
+	walked := make(chan error)
+	go func() {
+		_, err := f.Find("cmbx10")
+		walked <- err
+	}()
+	<-fsys.entered
+
+	// While one lookup walks a directory, others go ahead.
+	found := make(chan error)
+	go func() {
+		_, err := f.Find("cmr10")
+		found <- err
+	}()
+	select {
+	case err := <-found:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a lookup waited for another's directory walk")
+	}
+
+	// What the walk finds after the cache is cleared is not cached.
+	f.ClearCache()
+	close(fsys.release)
+	if err := <-walked; err != nil {
+		t.Fatal(err)
+	}
+	if len(f.found) != 0 || len(f.trees) != 0 {
+		t.Errorf("got lookups %v and trees %v cached after clearing the cache, want none", f.found, f.trees)
+	}
+}
@@ -0,0 +1,264 @@
+package tfm
+
+import (
+	"fmt"
+)
+
+// FontInstance is a font used at a particular size, as TeX makes one for
+// \font\x=cmr10 at 12pt or \font\x=cmr10 scaled 1200. Its parameters and
+// character metrics are in scaled points at that size, computed exactly as
+// TeX computes them. Instances of the same file share its TFM, which they do
+// not modify.
+type FontInstance struct {
+	tfm    *TFM
+	scaler Scaler
+
+	widths  []Scaled
+	heights []Scaled
+	depths  []Scaled
+	italics []Scaled
+	params  []Scaled
+}
+
+// At returns an instance of the font at the given size, as for "at size".
+// The size must be positive and less than MaxAtSize.
+func (tfm *TFM) At(size Scaled) (*FontInstance, error) {
+	scaler, err := NewScaler(size)
+	if err != nil {
+		return nil, err
+	}
+	fi := &FontInstance{
+		tfm:     tfm,
+		scaler:  scaler,
+		widths:  scaleTable(scaler, tfm.widths),
+		heights: scaleTable(scaler, tfm.heights),
+		depths:  scaleTable(scaler, tfm.depths),
+		italics: scaleTable(scaler, tfm.italics),
+		params:  make([]Scaled, tfm.NrParams()),
+	}
+	for i, fw := range tfm.params {
+		fi.params[i] = scaler.Scale(fw)
+	}
+	// The slant is a pure number, not a length, so TeX keeps it unscaled,
+	// converting it from a fix-word to the precision of a scaled.
+	fi.params[0] = Scaled(tfm.Slant() >> 4)
+	return fi, nil
+}
+
+// Scaled returns an instance of the font at its design size magnified by
+// n/1000, as for "scaled n". n must be between 1 and 32768.
+func (tfm *TFM) Scaled(n int) (*FontInstance, error) {
+	size, err := tfm.scaledSize(n)
+	if err != nil {
+		return nil, err
+	}
+	return tfm.At(size)
+}
+
+// scaledSize returns the size of the font for "scaled n".
+func (tfm *TFM) scaledSize(n int) (Scaled, error) {
+	if n <= 0 || n > 32768 {
+		return 0, SizeError{msg: fmt.Sprintf("Illegal magnification %v: must be between 1 and 32768", n)}
+	}
+	return Scaled(int64(tfm.DesignSizeScaled()) * int64(n) / 1000), nil
+}
+
+// Clone returns a copy of the instance whose parameters can be set without
+// affecting the original. The character metrics, which cannot be changed,
+// are shared.
+func (fi *FontInstance) Clone() *FontInstance {
+	clone := *fi
+	clone.params = append([]Scaled(nil), fi.params...)
+	return &clone
+}
+
+func scaleTable(scaler Scaler, fws []FixWord) []Scaled {
+	ss := make([]Scaled, len(fws))
+	for i, fw := range fws {
+		ss[i] = scaler.Scale(fw)
+	}
+	return ss
+}
+
+// TFM returns a copy of the font metrics the instance was made from, which
+// are shared with other instances and so are not modified.
+func (fi *FontInstance) TFM() *TFM {
+	return fi.tfm.Clone()
+}
+
+// Size returns the size the font is used at.
+func (fi *FontInstance) Size() Scaled {
+	return fi.scaler.Size()
+}
+
+// Scale converts a fix-word from the font, such as a kern from a
+// LigKernResult, to scaled points at the instance's size.
+func (fi *FontInstance) Scale(fw FixWord) Scaled {
+	return fi.scaler.Scale(fw)
+}
+
+func (fi *FontInstance) param(n int) Scaled {
+	if n > len(fi.params) {
+		return 0
+	}
+	return fi.params[n-1]
+}
+
+// NrParams returns the number of parameters the instance has: those of its
+// font, and any added with SetParam.
+func (fi *FontInstance) NrParams() int {
+	return len(fi.params)
+}
+
+// Param returns parameter n of the instance, as \fontdimen n does. ok is
+// false if n is not between 1 and NrParams.
+func (fi *FontInstance) Param(n int) (v Scaled, ok bool) {
+	if n < 1 || n > len(fi.params) {
+		return 0, false
+	}
+	return fi.params[n-1], true
+}
+
+// SetParam sets parameter n of the instance, as an assignment to \fontdimen n
+// does, adding zero parameters to extend the instance up to n if it has
+// fewer. TeX only lets the most recently loaded font be extended; enforcing
+// that is up to the caller. The font's TFM and other instances of it are not
+// affected.
+func (fi *FontInstance) SetParam(n int, v Scaled) error {
+	if n < 1 {
+		return ParamError{msg: fmt.Sprintf("Font parameter number %v is not positive", n)}
+	}
+	for len(fi.params) < n {
+		fi.params = append(fi.params, 0)
+	}
+	fi.params[n-1] = v
+	return nil
+}
+
+// Slant returns the slant per point of height, which does not depend on the
+// size.
+func (fi *FontInstance) Slant() Scaled {
+	return fi.param(1)
+}
+
+// Space returns the normal interword space.
+func (fi *FontInstance) Space() Scaled {
+	return fi.param(2)
+}
+
+// SpaceStretch returns the stretch of interword glue.
+func (fi *FontInstance) SpaceStretch() Scaled {
+	return fi.param(3)
+}
+
+// SpaceShrink returns the shrink of interword glue.
+func (fi *FontInstance) SpaceShrink() Scaled {
+	return fi.param(4)
+}
+
+// XHeight returns the x-height, the size of an ex.
+func (fi *FontInstance) XHeight() Scaled {
+	return fi.param(5)
+}
+
+// Quad returns the size of an em.
+func (fi *FontInstance) Quad() Scaled {
+	return fi.param(6)
+}
+
+// ExtraSpace returns the extra space added after sentence-ending punctuation
+// when \spacefactor is 2000 or more.
+func (fi *FontInstance) ExtraSpace() Scaled {
+	return fi.param(7)
+}
+
+// MathSymbolParams returns the additional parameters of a math symbols font,
+// scaled. They are only meaningful if the font has the math symbols coding
+// scheme.
+func (fi *FontInstance) MathSymbolParams() ScaledMathSymbolParams {
+	return ScaledMathSymbolParams{
+		Num1:       fi.param(8),
+		Num2:       fi.param(9),
+		Num3:       fi.param(10),
+		Denom1:     fi.param(11),
+		Denom2:     fi.param(12),
+		Sup1:       fi.param(13),
+		Sup2:       fi.param(14),
+		Sup3:       fi.param(15),
+		Sub1:       fi.param(16),
+		Sub2:       fi.param(17),
+		Supdrop:    fi.param(18),
+		Subdrop:    fi.param(19),
+		Delim1:     fi.param(20),
+		Delim2:     fi.param(21),
+		AxisHeight: fi.param(22),
+	}
+}
+
+// MathExtensionParams returns the additional parameters of a math extension
+// font, scaled. They are only meaningful if the font has the math extension
+// coding scheme.
+func (fi *FontInstance) MathExtensionParams() ScaledMathExtensionParams {
+	var bigOpSpacing [5]Scaled
+	for i := range bigOpSpacing {
+		bigOpSpacing[i] = fi.param(9 + i)
+	}
+	return ScaledMathExtensionParams{
+		DefaultRuleThickness: fi.param(8),
+		BigOpSpacing:         bigOpSpacing,
+	}
+}
+
+// CharMetrics returns the width, height, depth and italic correction of a
+// character at the instance's size. ok is false as for TFM.CharDimensions.
+func (fi *FontInstance) CharMetrics(code byte) (width, height, depth, italic Scaled, ok bool) {
+	ci, ok := fi.tfm.charInfo(code)
+	if !ok {
+		return
+	}
+	if int(ci.widthIndex) >= len(fi.widths) ||
+		int(ci.heightIndex) >= len(fi.heights) ||
+		int(ci.depthIndex) >= len(fi.depths) ||
+		int(ci.italicIndex) >= len(fi.italics) {
+		return 0, 0, 0, 0, false
+	}
+	return fi.widths[ci.widthIndex], fi.heights[ci.heightIndex], fi.depths[ci.depthIndex], fi.italics[ci.italicIndex], true
+}
+
+// Kern returns the kern between the pair of characters left and right at the
+// instance's size. ok is false if the font has no kern for the pair,
+// including when it has a ligature for it instead.
+func (fi *FontInstance) Kern(left, right byte) (kern Scaled, ok bool) {
+	res, ok := fi.tfm.LookupLigKern(left, right)
+	if !ok || res.IsLigature {
+		return 0, false
+	}
+	return fi.Scale(res.Kern), true
+}
+
+// ScaledMathSymbolParams holds a math symbols font's additional parameters
+// in scaled points.
+type ScaledMathSymbolParams struct {
+	Num1       Scaled
+	Num2       Scaled
+	Num3       Scaled
+	Denom1     Scaled
+	Denom2     Scaled
+	Sup1       Scaled
+	Sup2       Scaled
+	Sup3       Scaled
+	Sub1       Scaled
+	Sub2       Scaled
+	Supdrop    Scaled
+	Subdrop    Scaled
+	Delim1     Scaled
+	Delim2     Scaled
+	AxisHeight Scaled
+}
+
+// ScaledMathExtensionParams holds a math extension font's additional
+// parameters in scaled points.
+type ScaledMathExtensionParams struct {
+	DefaultRuleThickness Scaled
+	BigOpSpacing         [5]Scaled
+}
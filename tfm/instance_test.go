@@ -0,0 +1,155 @@
+package tfm
+
+import (
+	"testing"
+)
+
+// cmr10PL has some of cmr10's metrics, as TFtoPL writes them.
+const cmr10PL = `(FAMILY CMR)
+(DESIGNSIZE R 10.0)
+(FONTDIMEN
+   (SLANT R 0.0)
+   (SPACE R 0.333334)
+   (STRETCH R 0.166667)
+   (SHRINK R 0.111112)
+   (XHEIGHT R 0.430555)
+   (QUAD R 1.000003)
+   (EXTRASPACE R 0.111112)
+   )
+(LIGTABLE
+   (LABEL C A)
+   (KRN C W R -0.083334)
+   (STOP)
+   )
+(CHARACTER C A
+   (CHARWD R 0.750002)
+   (CHARHT R 0.683332)
+   )
+(CHARACTER C W
+   (CHARWD R 1.027781)
+   (CHARHT R 0.683332)
+   (CHARIC R 0.013888)
+   )
+(CHARACTER C f
+   (CHARWD R 0.305557)
+   (CHARHT R 0.694445)
+   (CHARIC R 0.077779)
+   )
+(CHARACTER C g
+   (CHARWD R 0.500002)
+   (CHARHT R 0.430555)
+   (CHARDP R 0.194445)
+   (CHARIC R 0.013888)
+   )
+`
+
+func TestInstanceAt(t *testing.T) {
+	font := loadPL(t, cmr10PL)
+	at, err := font.At(twelvePoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scaled, err := font.Scaled(1200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What TeX gives for \font\x=cmr10 at 12pt, and for scaled 1200.
+	metrics := []struct {
+		code                         byte
+		width, height, depth, italic Scaled
+	}{
+		{'A', 589825, 537394, 0, 0},
+		{'W', 808279, 537394, 0, 10922},
+		{'f', 240300, 546133, 0, 61167},
+		{'g', 393217, 338602, 152917, 10922},
+	}
+	params := []Scaled{0, 262144, 131072, 87381, 338602, 786434, 87381}
+	for _, fi := range []*FontInstance{at, scaled} {
+		if got := fi.Size(); got != twelvePoint {
+			t.Errorf("got size %v, want 12.0pt", got)
+		}
+		for _, m := range metrics {
+			w, h, d, i, ok := fi.CharMetrics(m.code)
+			if !ok || w != m.width || h != m.height || d != m.depth || i != m.italic {
+				t.Errorf("%q: got %v %v %v %v %v, want %v %v %v %v", m.code,
+					int32(w), int32(h), int32(d), int32(i), ok,
+					int32(m.width), int32(m.height), int32(m.depth), int32(m.italic))
+			}
+		}
+		for n, want := range params {
+			if got, ok := fi.Param(n + 1); !ok || got != want {
+				t.Errorf("parameter %v: got %v, %v, want %v", n+1, int32(got), ok, int32(want))
+			}
+		}
+		if got, ok := fi.Kern('A', 'W'); !ok || got != -65537 {
+			t.Errorf("kern between A and W: got %v, %v, want -65537", int32(got), ok)
+		}
+	}
+}
+
+func TestInstanceSlant(t *testing.T) {
+	tests := []struct {
+		slant string
+		want  Scaled
+	}{
+		// The slant of cmti10, which TeX shows as 0.25pt at any size.
+		{"0.25", 16384},
+		// A slant that is not a whole number of scaled points is rounded
+		// down, as TeX drops the fix-word's last four bits.
+		{"-0.1", -6554},
+	}
+	for _, test := range tests {
+		font := loadPL(t, "(DESIGNSIZE R 10.0)(FONTDIMEN (SLANT R "+test.slant+"))")
+		for _, size := range []Scaled{tenPoint, twelvePoint, 100 * Unity} {
+			fi, err := font.At(size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fi.Slant(); got != test.want {
+				t.Errorf("slant %v at %v: got %v, want %v", test.slant, size, int32(got), int32(test.want))
+			}
+		}
+	}
+}
+
+func TestInstanceSize(t *testing.T) {
+	font := loadPL(t, cmr10PL)
+	big := loadPL(t, "(DESIGNSIZE R 100.0)")
+	tests := []struct {
+		name string
+		make func() (*FontInstance, error)
+		size Scaled
+	}{
+		{"at 1sp", func() (*FontInstance, error) { return font.At(1) }, 1},
+		{"at just under 2048pt", func() (*FontInstance, error) { return font.At(MaxAtSize - 1) }, MaxAtSize - 1},
+		{"at 2048pt", func() (*FontInstance, error) { return font.At(MaxAtSize) }, 0},
+		{"at 0pt", func() (*FontInstance, error) { return font.At(0) }, 0},
+		{"at a negative size", func() (*FontInstance, error) { return font.At(-tenPoint) }, 0},
+		{"scaled 1", func() (*FontInstance, error) { return font.Scaled(1) }, 655},
+		{"scaled 32768", func() (*FontInstance, error) { return font.Scaled(32768) }, 21474836},
+		{"scaled 32769", func() (*FontInstance, error) { return font.Scaled(32769) }, 0},
+		{"scaled 0", func() (*FontInstance, error) { return font.Scaled(0) }, 0},
+		{"scaled -1000", func() (*FontInstance, error) { return font.Scaled(-1000) }, 0},
+		// A 100pt font reaches 2048pt when magnified 20.48 times.
+		{"scaled 20470", func() (*FontInstance, error) { return big.Scaled(20470) }, 2047 * Unity},
+		{"scaled 20480", func() (*FontInstance, error) { return big.Scaled(20480) }, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fi, err := test.make()
+			if test.size == 0 {
+				if _, ok := err.(SizeError); !ok {
+					t.Errorf("got %v, want a SizeError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fi.Size(); got != test.size {
+				t.Errorf("got size %v, want %v", int32(got), int32(test.size))
+			}
+		})
+	}
+}
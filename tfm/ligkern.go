@@ -0,0 +1,248 @@
+package tfm
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// An instruction whose skip byte exceeds stopFlag is the last in its
+	// program; as the first instruction of a program it instead redirects to
+	// the real start of a large program.
+	stopFlag = 128
+	// A skip byte of boundaryFlag in the first instruction names the right
+	// boundary character; in the last instruction it points to the left
+	// boundary program.
+	boundaryFlag = 255
+	// An op byte of at least kernFlag denotes a kern rather than a ligature.
+	kernFlag = 128
+)
+
+// LigOp is one of the eight ligature operations, encoded as in the op byte
+// of a lig/kern instruction: 4a+2b+c, where b and c say whether to keep the
+// left and right characters, and a says how many characters to skip over
+// afterwards.
+type LigOp uint8
+
+const (
+	LigOpReplace         LigOp = 0  // =:
+	LigOpKeepRight       LigOp = 1  // =:|
+	LigOpKeepLeft        LigOp = 2  // |=:
+	LigOpKeepBoth        LigOp = 3  // |=:|
+	LigOpKeepRightSkip   LigOp = 5  // =:|>
+	LigOpKeepLeftSkip    LigOp = 6  // |=:>
+	LigOpKeepBothSkip    LigOp = 7  // |=:|>
+	LigOpKeepBothSkipTwo LigOp = 11 // |=:|>>
+)
+
+var ligOpNames = map[LigOp]string{
+	LigOpReplace:         "=:",
+	LigOpKeepRight:       "=:|",
+	LigOpKeepLeft:        "|=:",
+	LigOpKeepBoth:        "|=:|",
+	LigOpKeepRightSkip:   "=:|>",
+	LigOpKeepLeftSkip:    "|=:>",
+	LigOpKeepBothSkip:    "|=:|>",
+	LigOpKeepBothSkipTwo: "|=:|>>",
+}
+
+func (op LigOp) String() string {
+	if name, ok := ligOpNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("LigOp(%d)", uint8(op))
+}
+
+// Valid returns whether op is one of the eight ligature operations.
+func (op LigOp) Valid() bool {
+	_, ok := ligOpNames[op]
+	return ok
+}
+
+// KeepLeft returns whether the left character is kept in front of the
+// ligature character.
+func (op LigOp) KeepLeft() bool {
+	return op&2 != 0
+}
+
+// KeepRight returns whether the right character is kept after the ligature
+// character.
+func (op LigOp) KeepRight() bool {
+	return op&1 != 0
+}
+
+// Skip returns the number of characters to move past before looking for
+// further ligatures and kerns.
+func (op LigOp) Skip() int {
+	return int(op >> 2)
+}
+
+// LigKernResult is the outcome of running a lig/kern program for a pair of
+// characters: either a kern to insert between them, or a ligature.
+type LigKernResult struct {
+	IsLigature bool
+	// Kern is the kern amount as a multiple of the design size, if the
+	// result is a kern.
+	Kern FixWord
+	// Op and Char are the ligature operation and the ligature character, if
+	// the result is a ligature.
+	Op   LigOp
+	Char byte
+}
+
+type ligKernInstruction struct {
+	skipByte  uint8
+	nextChar  uint8
+	opByte    uint8
+	remainder uint8
+}
+
+func readLigKernInstruction(r io.Reader) (lk ligKernInstruction, err error) {
+	word, err := read4bui(r)
+	if err != nil {
+		return
+	}
+	lk = ligKernInstruction{
+		skipByte:  uint8(word >> 24),
+		nextChar:  uint8(word >> 16),
+		opByte:    uint8(word >> 8),
+		remainder: uint8(word),
+	}
+	return
+}
+
+// restart returns the location an instruction points to, for large program
+// redirections and the left boundary program.
+func (lk ligKernInstruction) restart() int {
+	return 256*int(lk.opByte) + int(lk.remainder)
+}
+
+func (tfm *TFM) readLigKerns(r io.ReadSeeker) (err error) {
+	if _, err = r.Seek(tfm.tablePointers[LigKern], io.SeekStart); err != nil {
+		return
+	}
+	n := int(tfm.tableLengthsWords[LigKern])
+	tfm.ligKerns = make([]ligKernInstruction, n, n)
+	for i := range tfm.ligKerns {
+		if tfm.ligKerns[i], err = readLigKernInstruction(r); err != nil {
+			return readError(err, "lig/kern table")
+		}
+	}
+	tfm.boundaryCharLabel = -1
+	if n > 0 {
+		if first := tfm.ligKerns[0]; first.skipByte == boundaryFlag {
+			tfm.boundaryChar = first.nextChar
+			tfm.hasBoundaryChar = true
+		}
+		if last := tfm.ligKerns[n-1]; last.skipByte == boundaryFlag {
+			tfm.boundaryCharLabel = last.restart()
+		}
+	}
+	return nil
+}
+
+// BoundaryChar returns the character that stands for a word boundary on the
+// right of a character in lig/kern programs, if the font has one.
+func (tfm *TFM) BoundaryChar() (c byte, ok bool) {
+	return tfm.boundaryChar, tfm.hasBoundaryChar
+}
+
+// ligKernStart returns the location of the first instruction of a
+// character's lig/kern program, or -1 if it has none.
+func (tfm *TFM) ligKernStart(code byte) int {
+	ci, ok := tfm.charInfo(code)
+	if !ok || ci.tag != LigTag {
+		return -1
+	}
+	return tfm.programStart(int(ci.remainder))
+}
+
+// programStart follows the redirection of a large program, if the
+// instruction at i is one.
+func (tfm *TFM) programStart(i int) int {
+	if i < 0 || i >= len(tfm.ligKerns) {
+		return -1
+	}
+	if lk := tfm.ligKerns[i]; lk.skipByte > stopFlag {
+		return lk.restart()
+	}
+	return i
+}
+
+// runLigKern runs the program starting at location k, looking for an
+// instruction for the right character.
+func (tfm *TFM) runLigKern(k int, right byte) (res LigKernResult, ok bool) {
+	for k >= 0 && k < len(tfm.ligKerns) {
+		lk := tfm.ligKerns[k]
+		if lk.nextChar == right && lk.skipByte <= stopFlag {
+			if lk.opByte >= kernFlag {
+				i := 256*int(lk.opByte-kernFlag) + int(lk.remainder)
+				if i >= len(tfm.kerns) {
+					return
+				}
+				res.Kern = tfm.kerns[i]
+				return res, true
+			}
+			op := LigOp(lk.opByte)
+			if !op.Valid() {
+				return
+			}
+			return LigKernResult{IsLigature: true, Op: op, Char: lk.remainder}, true
+		}
+		if lk.skipByte >= stopFlag {
+			return
+		}
+		k += int(lk.skipByte) + 1
+	}
+	return
+}
+
+// LookupLigKern returns the kern or ligature for the pair of characters left
+// and right, if the left character's program has an instruction for it.
+func (tfm *TFM) LookupLigKern(left, right byte) (LigKernResult, bool) {
+	return tfm.runLigKern(tfm.ligKernStart(left), right)
+}
+
+// LeftBoundaryLigKern returns the kern or ligature for a word boundary
+// followed by the right character, using the font's boundary program.
+func (tfm *TFM) LeftBoundaryLigKern(right byte) (LigKernResult, bool) {
+	if tfm.boundaryCharLabel < 0 {
+		return LigKernResult{}, false
+	}
+	return tfm.runLigKern(tfm.boundaryCharLabel, right)
+}
+
+// RightBoundaryLigKern returns the kern or ligature for the left character
+// followed by a word boundary, which the left character's program matches
+// via the font's boundary character.
+func (tfm *TFM) RightBoundaryLigKern(left byte) (LigKernResult, bool) {
+	if !tfm.hasBoundaryChar {
+		return LigKernResult{}, false
+	}
+	return tfm.LookupLigKern(left, tfm.boundaryChar)
+}
+
+// DefaultSkewChar returns the \skewchar that plain TeX assigns to fonts of
+// this font's coding scheme, if any: '177 for math italic and '60 for math
+// symbols.
+func (tfm *TFM) DefaultSkewChar() (c byte, ok bool) {
+	switch tfm.codingSchemeKey() {
+	case mathItalicScheme:
+		return 0177, true
+	case mathSymbolsScheme:
+		return 060, true
+	}
+	return 0, false
+}
+
+// SkewKern returns the amount, as a multiple of the design size, by which a
+// math accent over a character should be shifted right: the kern between the
+// character and the font's skew character. The result is zero if there is no
+// such kern.
+func (tfm *TFM) SkewKern(code, skewChar byte) FixWord {
+	res, ok := tfm.LookupLigKern(code, skewChar)
+	if !ok || res.IsLigature {
+		return 0
+	}
+	return res.Kern
+}
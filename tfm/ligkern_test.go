@@ -0,0 +1,161 @@
+package tfm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// ligKernPL returns a font whose lig/kern table has every ligature operation,
+// a skip, a stop, a boundary character of 255, kerns past the first 256 and a
+// program far enough into the table to need a redirection.
+func ligKernPL() string {
+	var b strings.Builder
+	b.WriteString(`(DESIGNSIZE R 10.0)
+(BOUNDARYCHAR O 377)
+(LIGTABLE
+   (LABEL C A)
+   (LIG C A C B)
+   (LIG/ C B C B)
+   (/LIG C C C B)
+   (/LIG/ C D C B)
+   (LIG/> C E C B)
+   (/LIG> C F C B)
+   (/LIG/> C G C B)
+   (/LIG/>> C H C B)
+   (KRN O 377 R 0.5)
+   (STOP)
+   (LABEL C B)
+   (KRN C A R 0.1)
+   (SKIP D 2)
+   (KRN C B R 0.2)
+   (KRN C C R 0.3)
+   (KRN C D R -0.3)
+   (STOP)
+   (LABEL C C)
+   (LABEL BOUNDARYCHAR)
+   (KRN C A R 0.4)
+   (STOP)
+   (LABEL C D)
+   (KRN C C R 0.6)
+   (STOP)
+`)
+	// E and F have 300 different kerns between them, so that F's last kerns
+	// are past the first 256, and G's program starts past instruction 255.
+	b.WriteString("   (LABEL C E)\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, "   (KRN O %o R %v)\n", i, 1+0.001*float64(i+1))
+	}
+	b.WriteString("   (STOP)\n   (LABEL C F)\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, "   (KRN O %o R %v)\n", i, 1+0.001*float64(i+201))
+	}
+	b.WriteString(`   (STOP)
+   (LABEL C G)
+   (KRN C A R 1.5)
+   (STOP)
+   )
+`)
+	for c := 'A'; c <= 'H'; c++ {
+		fmt.Fprintf(&b, "(CHARACTER C %c (CHARWD R 0.5))\n", c)
+	}
+	return b.String()
+}
+
+func TestLookupLigKern(t *testing.T) {
+	font := loadPL(t, ligKernPL())
+	fix := func(s string) FixWord {
+		v, err := parseFix(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	lig := func(op LigOp) LigKernResult {
+		return LigKernResult{IsLigature: true, Op: op, Char: 'B'}
+	}
+	kern := func(s string) LigKernResult {
+		return LigKernResult{Kern: fix(s)}
+	}
+
+	// The fixture must have the features it is meant to test.
+	if ci, _ := font.charInfo('G'); font.ligKerns[ci.remainder].skipByte <= stopFlag {
+		t.Fatal("G's program is not reached by a redirection")
+	}
+	if k := font.ligKernStart('F') + 99; font.ligKerns[k].opByte <= kernFlag {
+		t.Fatalf("F's last kern has op byte %v, want one past the kern flag", font.ligKerns[k].opByte)
+	}
+
+	tests := []struct {
+		name        string
+		left, right byte
+		want        LigKernResult
+		ok          bool
+	}{
+		{"=:", 'A', 'A', lig(LigOpReplace), true},
+		{"=:|", 'A', 'B', lig(LigOpKeepRight), true},
+		{"|=:", 'A', 'C', lig(LigOpKeepLeft), true},
+		{"|=:|", 'A', 'D', lig(LigOpKeepBoth), true},
+		{"=:|>", 'A', 'E', lig(LigOpKeepRightSkip), true},
+		{"|=:>", 'A', 'F', lig(LigOpKeepLeftSkip), true},
+		{"|=:|>", 'A', 'G', lig(LigOpKeepBothSkip), true},
+		{"|=:|>>", 'A', 'H', lig(LigOpKeepBothSkipTwo), true},
+		{"right boundary", 'A', 0377, kern("0.5"), true},
+		{"no instruction", 'A', 'Z', LigKernResult{}, false},
+		{"before skip", 'B', 'A', kern("0.1"), true},
+		{"skipped", 'B', 'B', LigKernResult{}, false},
+		{"skipped again", 'B', 'C', LigKernResult{}, false},
+		{"after skip", 'B', 'D', kern("-0.3"), true},
+		{"stop", 'C', 'A', kern("0.4"), true},
+		{"past stop", 'C', 'C', LigKernResult{}, false},
+		{"no right boundary", 'C', 0377, LigKernResult{}, false},
+		{"kern in the first 256", 'E', 0307, kern("1.2"), true},
+		{"kern past the first 256", 'F', 0143, kern("1.3"), true},
+		{"redirection", 'G', 'A', kern("1.5"), true},
+		{"no program", 'H', 'A', LigKernResult{}, false},
+		{"no character", 'Z', 'A', LigKernResult{}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := font.LookupLigKern(test.left, test.right)
+			if got != test.want || ok != test.ok {
+				t.Errorf("got %+v, %v, want %+v, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+
+	if got, ok := font.RightBoundaryLigKern('A'); !ok || got != kern("0.5") {
+		t.Errorf("right boundary after A: got %+v, %v, want the kern 0.5", got, ok)
+	}
+	if got, ok := font.LeftBoundaryLigKern('A'); !ok || got != kern("0.4") {
+		t.Errorf("left boundary before A: got %+v, %v, want the kern 0.4", got, ok)
+	}
+}
+
+func TestLigOp(t *testing.T) {
+	tests := []struct {
+		op                  LigOp
+		keepLeft, keepRight bool
+		skip                int
+	}{
+		{LigOpReplace, false, false, 0},
+		{LigOpKeepRight, false, true, 0},
+		{LigOpKeepLeft, true, false, 0},
+		{LigOpKeepBoth, true, true, 0},
+		{LigOpKeepRightSkip, false, true, 1},
+		{LigOpKeepLeftSkip, true, false, 1},
+		{LigOpKeepBothSkip, true, true, 1},
+		{LigOpKeepBothSkipTwo, true, true, 2},
+	}
+	for _, test := range tests {
+		if !test.op.Valid() || test.op.KeepLeft() != test.keepLeft || test.op.KeepRight() != test.keepRight || test.op.Skip() != test.skip {
+			t.Errorf("%v: got valid %v, keep left %v, keep right %v, skip %v", test.op,
+				test.op.Valid(), test.op.KeepLeft(), test.op.KeepRight(), test.op.Skip())
+		}
+	}
+	for _, op := range []LigOp{4, 8, 9, 10, 12} {
+		if op.Valid() {
+			t.Errorf("%v is valid", op)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package tfm
+
+import (
+	"fmt"
+)
+
+// ParamError is returned when a font parameter number is out of range.
+type ParamError struct {
+	msg string
+}
+
+func (p ParamError) Error() string {
+	return p.msg
+}
+
+// NrParams returns the number of parameters the font has. It is never fewer
+// than seven: as in TeX, a font that carries fewer has the rest as zero.
+func (tfm *TFM) NrParams() int {
+	if len(tfm.params) < 7 {
+		return 7
+	}
+	return len(tfm.params)
+}
+
+// Param returns parameter n of the font, as a multiple of the design size
+// except for the slant, parameter 1, which is a pure number. Parameters are
+// numbered from 1, as for \fontdimen. ok is false if n is not between 1 and
+// NrParams.
+func (tfm *TFM) Param(n int) (v FixWord, ok bool) {
+	if n < 1 || n > tfm.NrParams() {
+		return 0, false
+	}
+	return tfm.param(n), true
+}
+
+// param returns parameter n, or zero if the font does not carry it.
+func (tfm *TFM) param(n int) FixWord {
+	if n > len(tfm.params) {
+		return 0
+	}
+	return tfm.params[n-1]
+}
+
+// SetParam sets parameter n of the font, adding zero parameters to extend the
+// font up to n if it has fewer. The change is seen by instances made
+// afterwards, not by existing ones.
+func (tfm *TFM) SetParam(n int, v FixWord) error {
+	if n < 1 {
+		return ParamError{msg: fmt.Sprintf("Font parameter number %v is not positive", n)}
+	}
+	for len(tfm.params) < n {
+		tfm.params = append(tfm.params, 0)
+	}
+	tfm.params[n-1] = v
+	return nil
+}
+
+// Clone returns a copy of the font whose parameters can be set without
+// affecting the original. The rest of its metrics, which cannot be changed,
+// are shared.
+func (tfm *TFM) Clone() *TFM {
+	clone := *tfm
+	clone.params = append([]FixWord(nil), tfm.params...)
+	return &clone
+}
+
+// Slant returns the slant per unit height.
+func (tfm *TFM) Slant() FixWord {
+	return tfm.param(1)
+}
+
+// Space returns the normal interword space.
+func (tfm *TFM) Space() FixWord {
+	return tfm.param(2)
+}
+
+// SpaceStretch returns the stretch of interword glue.
+func (tfm *TFM) SpaceStretch() FixWord {
+	return tfm.param(3)
+}
+
+// SpaceShrink returns the shrink of interword glue.
+func (tfm *TFM) SpaceShrink() FixWord {
+	return tfm.param(4)
+}
+
+// XHeight returns the x-height, the size of an ex.
+func (tfm *TFM) XHeight() FixWord {
+	return tfm.param(5)
+}
+
+// Quad returns the size of an em.
+func (tfm *TFM) Quad() FixWord {
+	return tfm.param(6)
+}
+
+// ExtraSpace returns the extra space added after sentence-ending punctuation
+// when \spacefactor is 2000 or more.
+func (tfm *TFM) ExtraSpace() FixWord {
+	return tfm.param(7)
+}
+
+// MathSymbolParams returns the 15 additional parameters of a math symbols
+// font, parameters 8 to 22. They are zero unless the font has the math
+// symbols coding scheme.
+func (tfm *TFM) MathSymbolParams() MathSymbolParams {
+	if tfm.codingSchemeKey() != mathSymbolsScheme {
+		return MathSymbolParams{}
+	}
+	return MathSymbolParams{
+		Num1:       tfm.param(8),
+		Num2:       tfm.param(9),
+		Num3:       tfm.param(10),
+		Denom1:     tfm.param(11),
+		Denom2:     tfm.param(12),
+		Sup1:       tfm.param(13),
+		Sup2:       tfm.param(14),
+		Sup3:       tfm.param(15),
+		Sub1:       tfm.param(16),
+		Sub2:       tfm.param(17),
+		Supdrop:    tfm.param(18),
+		Subdrop:    tfm.param(19),
+		Delim1:     tfm.param(20),
+		Delim2:     tfm.param(21),
+		AxisHeight: tfm.param(22),
+	}
+}
+
+// MathExtensionParams returns the 6 additional parameters of a math
+// extension font, parameters 8 to 13. They are zero unless the font has the
+// math extension coding scheme, or is an Euler substitutions font, which
+// carries the same parameters.
+func (tfm *TFM) MathExtensionParams() MathExtensionParams {
+	switch tfm.codingSchemeKey() {
+	case mathExtensionScheme, eulerSubstitutionsScheme:
+	default:
+		return MathExtensionParams{}
+	}
+	var bigOpSpacing [5]FixWord
+	for i := range bigOpSpacing {
+		bigOpSpacing[i] = tfm.param(9 + i)
+	}
+	return MathExtensionParams{
+		DefaultRuleThickness: tfm.param(8),
+		BigOpSpacing:         bigOpSpacing,
+	}
+}
@@ -1,12 +1,45 @@
-package main
+package tfm
 
 import (
 	"fmt"
 	"io"
-	"os"
+	"io/fs"
+	"strings"
+
+	"github.com/eddiejessup/gnex/vfs"
 )
 
+// TruncatedError is returned when a TFM file ends before all of the data its
+// header promises.
+type TruncatedError struct {
+	msg string
+}
+
+func (p TruncatedError) Error() string {
+	return p.msg
+}
+
+// TableLengthError is returned when the table lengths in a TFM file are
+// inconsistent with each other or with the file length.
+type TableLengthError struct {
+	msg string
+}
+
+func (p TableLengthError) Error() string {
+	return p.msg
+}
+
+// HeaderError is returned when the header table of a TFM file is malformed.
+type HeaderError struct {
+	msg string
+}
+
+func (p HeaderError) Error() string {
+	return p.msg
+}
+
 type Table int
+
 const (
 	Header Table = iota
 	CharacterInfo
@@ -20,219 +53,374 @@ const (
 	FontParameter
 )
 const (
-	NrTables = FontParameter + 1
-	HeaderDataLengthWordsMin = 18
-    // The header starts at 24 bytes.
-	HeaderPointer = 24
+	NrTables                 = FontParameter + 1
+	HeaderDataLengthWordsMin = 2
+	// The header starts at 24 bytes.
+	HeaderPointer               = 24
 	CharacterCodingSchemeLength = 40
-    FamilyLength = 20
+	FamilyLength                = 20
+	// Header lengths, in words, needed to hold each optional header field.
+	characterCodingSchemeHeaderLength = 12
+	familyHeaderLength                = 17
+	faceHeaderLength                  = 18
+)
+
+// Coding schemes that affect how a font is interpreted, as returned by
+// codingSchemeKey.
+const (
+	mathItalicScheme         = "TEX MATH ITALIC"
+	mathSymbolsScheme        = "TEX MATH SYMBOLS"
+	mathExtensionScheme      = "TEX MATH EXTENSION"
+	eulerSubstitutionsScheme = "EULER SUBSTITUTIONS ONLY"
 )
 
+var tableNames = [...]string{
+	"Header",
+	"CharacterInfo",
+	"Width",
+	"Height",
+	"Depth",
+	"ItalicCorrection",
+	"LigKern",
+	"Kern",
+	"ExtensibleCharacter",
+	"FontParameter",
+}
+
+func (t Table) String() string {
+	if t < 0 || int(t) >= len(tableNames) {
+		return fmt.Sprintf("Table(%d)", int(t))
+	}
+	return tableNames[t]
+}
+
 type MathSymbolParams struct {
-	Num1 float64
-	Num2 float64
-	Num3 float64
-	Denom1 float64
-	Denom2 float64
-	Sup1 float64
-	Sup2 float64
-	Sup3 float64
-	Sub1 float64
-	Sub2 float64
-	Supdrop float64
-	Subdrop float64
-	Delim1 float64
-	Delim2 float64
-	AxisHeight float64
+	Num1       FixWord
+	Num2       FixWord
+	Num3       FixWord
+	Denom1     FixWord
+	Denom2     FixWord
+	Sup1       FixWord
+	Sup2       FixWord
+	Sup3       FixWord
+	Sub1       FixWord
+	Sub2       FixWord
+	Supdrop    FixWord
+	Subdrop    FixWord
+	Delim1     FixWord
+	Delim2     FixWord
+	AxisHeight FixWord
 }
 
 type MathExtensionParams struct {
-	DefaultRuleThickness float64
-	BigOpSpacing [5]float64
+	DefaultRuleThickness FixWord
+	BigOpSpacing         [5]FixWord
 }
 
 type TFM struct {
-	fileLengthWords uint16
+	fileLengthWords       uint16
 	headerDataLengthWords uint16
-	smallestCharCode uint16
-	largestCharCode uint16
-	tableLengthsWords []uint16
-	tablePointers []uint16
-	checksum uint32
-	designFontSize float64
+	smallestCharCode      uint16
+	largestCharCode       uint16
+	tableLengthsWords     []uint16
+	tablePointers         []int64
+	checksum              uint32
+	designFontSize        FixWord
 	characterCodingScheme string
-	family string
+	family                string
+	sevenBitSafe          bool
+	face                  Face
+	header                []byte
+
+	charInfos []charInfo
+	widths    []FixWord
+	heights   []FixWord
+	depths    []FixWord
+	italics   []FixWord
 
-	slant float64
-	spacing float64
-	spaceStretch float64
-	spaceShrink float64
-	xHeight float64
-	quad float64
-	extraSpace float64
+	ligKerns          []ligKernInstruction
+	kerns             []FixWord
+	boundaryChar      byte
+	hasBoundaryChar   bool
+	boundaryCharLabel int
+
+	extensibles []extensibleRecipe
+
+	params []FixWord
+}
 
-	MathSymbolParams MathSymbolParams
-	MathExtensionParams MathExtensionParams
+func (tfm *TFM) PositionInTable(table Table, indexWords uint16) int64 {
+	return tfm.tablePointers[table] + 4*int64(indexWords)
 }
 
-func (tfm *TFM) PositionInTable(table Table, indexWords uint16) uint16 {
-	return tfm.tablePointers[table] + 4 * indexWords
+// DesignSize returns the design size of the font, in points.
+func (tfm *TFM) DesignSize() float64 {
+	return tfm.designFontSize.Float()
 }
 
-func NewTFM(path string) *TFM {
-	file, err := os.Open(path)
+// DesignSizeScaled returns the design size of the font, exactly, in scaled
+// points.
+func (tfm *TFM) DesignSizeScaled() Scaled {
+	return Scaled(tfm.designFontSize >> 4)
+}
+
+// CharacterCodingScheme returns the coding scheme named in the header, such
+// as "TeX text", or the empty string if the header does not name one.
+func (tfm *TFM) CharacterCodingScheme() string {
+	return tfm.characterCodingScheme
+}
+
+// Family returns the font family named in the header, such as "CMR", or the
+// empty string if the header does not name one.
+func (tfm *TFM) Family() string {
+	return tfm.family
+}
+
+// codingSchemeKey returns the coding scheme in the form used to decide how
+// to interpret the font. Schemes are compared ignoring case, because fonts
+// made by PLtoTF carry them in upper case.
+func (tfm *TFM) codingSchemeKey() string {
+	return strings.ToUpper(tfm.characterCodingScheme)
+}
+
+// readError converts an error from the underlying reader into a
+// TruncatedError if it was caused by running off the end of the file.
+func readError(err error, what string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return TruncatedError{msg: fmt.Sprintf("File ended while reading %v", what)}
+	}
+	return err
+}
+
+// LoadFile reads a TFM file from the file system.
+func LoadFile(path string) (*TFM, error) {
+	return LoadFS(vfs.OS, path)
+}
+
+// LoadFS reads the TFM file at path in fsys.
+func LoadFS(fsys fs.FS, path string) (*TFM, error) {
+	r, done, err := vfs.ReadSeeker(fsys, path)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	defer done()
+	return Load(r)
+}
+
+// Load reads a TFM file from r, which must be positioned at the start of the
+// file.
+func Load(r io.ReadSeeker) (*TFM, error) {
+	fileLengthWords, err := read2bui(r)
+	if err != nil {
+		return nil, readError(err, "file length")
+	}
+	headerDataLengthWords, err := read2bui(r)
+	if err != nil {
+		return nil, readError(err, "header length")
+	}
+	smallestCharCode, err := read2bui(r)
+	if err != nil {
+		return nil, readError(err, "smallest character code")
+	}
+	largestCharCode, err := read2bui(r)
+	if err != nil {
+		return nil, readError(err, "largest character code")
 	}
-	fileLengthWords, _ := read2bui(file)
-	headerDataLengthWords, _ := read2bui(file)
-	smallestCharCode, _ := read2bui(file)
-	largestCharCode, _ := read2bui(file)
 
-	// Set table lengths.
-	tableLengthsWords := make([]uint16, NrTables, NrTables)
 	if headerDataLengthWords < HeaderDataLengthWordsMin {
-		headerDataLengthWords = HeaderDataLengthWordsMin
+		return nil, HeaderError{msg: fmt.Sprintf("Header length %v is less than the minimum %v", headerDataLengthWords, HeaderDataLengthWordsMin)}
 	}
+	if largestCharCode > 255 || smallestCharCode > largestCharCode+1 {
+		return nil, TableLengthError{msg: fmt.Sprintf("Bad character code range %v to %v", smallestCharCode, largestCharCode)}
+	}
+
+	// Set table lengths.
+	tableLengthsWords := make([]uint16, NrTables, NrTables)
 	tableLengthsWords[Header] = headerDataLengthWords
 
 	nrChars := largestCharCode - smallestCharCode + 1
 	tableLengthsWords[CharacterInfo] = nrChars
 
 	for table := Width; table < NrTables; table++ {
-		tableLength, _ := read2bui(file)
+		tableLength, err := read2bui(r)
+		if err != nil {
+			return nil, readError(err, "table lengths")
+		}
 		tableLengthsWords[table] = tableLength
 	}
 
-	tablePointers := make([]uint16, NrTables, NrTables)
+	for _, table := range []Table{Width, Height, Depth, ItalicCorrection} {
+		if tableLengthsWords[table] == 0 {
+			return nil, TableLengthError{msg: fmt.Sprintf("Table %v is empty, but must contain at least the zero entry", table)}
+		}
+	}
+	if tableLengthsWords[ExtensibleCharacter] > 256 {
+		return nil, TableLengthError{msg: fmt.Sprintf("Extensible character table has %v entries, more than 256", tableLengthsWords[ExtensibleCharacter])}
+	}
 
 	tfm := TFM{
-		fileLengthWords: fileLengthWords,
+		fileLengthWords:       fileLengthWords,
 		headerDataLengthWords: headerDataLengthWords,
-		smallestCharCode: smallestCharCode,
-		largestCharCode: largestCharCode,
-		tableLengthsWords: tableLengthsWords,
-		tablePointers: tablePointers,
-		MathSymbolParams: nil,
+		smallestCharCode:      smallestCharCode,
+		largestCharCode:       largestCharCode,
+		tableLengthsWords:     tableLengthsWords,
+		tablePointers:         make([]int64, NrTables, NrTables),
 	}
 
 	// Infer table pointers from table lengths.
 	tfm.tablePointers[Header] = HeaderPointer
 	for table := Header; table < FontParameter; table++ {
-		tfm.tablePointers[table + 1] = tfm.PositionInTable(table, tableLengthsWords[table])
+		tfm.tablePointers[table+1] = tfm.PositionInTable(table, tableLengthsWords[table])
 	}
 
 	validationFileLength := tfm.PositionInTable(FontParameter, tableLengthsWords[FontParameter])
-    if validationFileLength != fileLengthWords * 4 {
-        panic("Bad TFM file")
-    }
-
-    // Read header.
-	file.Seek(int64(tfm.tablePointers[Header]), io.SeekStart)
-
-    // Read header[0 ... 1].
-    tfm.checksum, _ = read4bui(file)
-    tfm.designFontSize, _ = readFixWord(file)
-
-    // Read header[2 ... 11] if present.
-    position, err := currentPosition(file)
-    if (err != nil) {
-    	panic(err)
-    }
-    characterInfoTablePosition := tfm.tablePointers[CharacterInfo]
-    if position < characterInfoTablePosition {
-        tfm.characterCodingScheme, err = readBCPL(file)
-        if (err != nil) {
-        	panic(err)
-        }
-    }
-
-    // Read header[12 ... 16] if present.
-    position += CharacterCodingSchemeLength
-    if position < characterInfoTablePosition {
-        tfm.family, err = readBCPLFrom(file, position)
-        if (err != nil) {
-        	panic(err)
-        }
-    }
-
-    // Read header[12 ... 16] if present.
-    position += FamilyLength
-    if position < characterInfoTablePosition {
-        // Seven bit safe flag; unused.
-        read1buiFrom(file, position)
-        // Unknown.
-        read2bui(file)
-        // Face; unused.
-        read1bui(file)
-    }
-
-    // Read font parameters.
-    file.Seek(int64(tfm.tablePointers[FontParameter]), io.SeekStart)
-
-    if tfm.characterCodingScheme == "TeX math italic" {
-        panic("Unsupported character coding scheme")
-    }
-
-    tfm.slant, _ = readFixWord(file)
-    tfm.spacing, _ = readFixWord(file)
-    tfm.spaceStretch, _ = readFixWord(file)
-    tfm.spaceShrink, _ = readFixWord(file)
-    tfm.xHeight, _ = readFixWord(file)
-    tfm.quad, _ = readFixWord(file)
-    tfm.extraSpace, _ = readFixWord(file)
-
-    switch tfm.characterCodingScheme {
-    case "TeX math symbols":
-        // Read the additional 15 fix-word parameters.
-        num1, _ := readFixWord(file)
-		num2, _ := readFixWord(file)
-		num3, _ := readFixWord(file)
-		denom1, _ := readFixWord(file)
-		denom2, _ := readFixWord(file)
-		sup1, _ := readFixWord(file)
-		sup2, _ := readFixWord(file)
-		sup3, _ := readFixWord(file)
-		sub1, _ := readFixWord(file)
-		sub2, _ := readFixWord(file)
-		supdrop, _ := readFixWord(file)
-		subdrop, _ := readFixWord(file)
-		delim1, _ := readFixWord(file)
-		delim2, _ := readFixWord(file)
-		axisHeight, _ := readFixWord(file)
-        tfm.MathSymbolParams = MathSymbolParams{
-	        Num1: num1,
-	        Num2: num2,
-	        Num3: num3,
-	        Denom1: denom1,
-	        Denom2: denom2,
-	        Sup1: sup1,
-	        Sup2: sup2,
-	        Sup3: sup3,
-	        Sub1: sub1,
-	        Sub2: sub2,
-	        Supdrop: supdrop,
-	        Subdrop: subdrop,
-	        Delim1: delim1,
-	        Delim2: delim2,
-	        AxisHeight: axisHeight,
-        }
-    case "TeX math extension", "euler substitutions only":
-        // Read the additional 6 fix-word parameters.
-    	defaultRuleThickness, _ := readFixWord(file)
-    	var bigOpSpacing [5]float64
-    	for i := range(bigOpSpacing) {
-    		bigOpSpacing[i], _ = readFixWord(file)
-    	}
-    	tfm.MathExtensionParams = MathExtensionParams{
-    		DefaultRuleThickness: defaultRuleThickness,
-    		BigOpSpacing: bigOpSpacing,
-    	}
-    }
-	return &tfm
-}
-
-func main() {
-	tfm := NewTFM("cmr10.tfm")
-    fmt.Printf("%v", tfm)
+	if validationFileLength != int64(fileLengthWords)*4 {
+		return nil, TableLengthError{msg: fmt.Sprintf("File length is %v words, but tables add up to %v words", fileLengthWords, validationFileLength/4)}
+	}
+
+	actualFileLength, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if actualFileLength < validationFileLength {
+		return nil, TruncatedError{msg: fmt.Sprintf("File is %v bytes long, but should be %v bytes", actualFileLength, validationFileLength)}
+	}
+
+	if err := tfm.readHeader(r); err != nil {
+		return nil, err
+	}
+	if err := tfm.readCharInfos(r); err != nil {
+		return nil, err
+	}
+	if tfm.widths, err = tfm.readFixWordTable(r, Width); err != nil {
+		return nil, err
+	}
+	if tfm.heights, err = tfm.readFixWordTable(r, Height); err != nil {
+		return nil, err
+	}
+	if tfm.depths, err = tfm.readFixWordTable(r, Depth); err != nil {
+		return nil, err
+	}
+	if tfm.italics, err = tfm.readFixWordTable(r, ItalicCorrection); err != nil {
+		return nil, err
+	}
+	if err := tfm.readLigKerns(r); err != nil {
+		return nil, err
+	}
+	if tfm.kerns, err = tfm.readFixWordTable(r, Kern); err != nil {
+		return nil, err
+	}
+	if err := tfm.readExtensibleRecipes(r); err != nil {
+		return nil, err
+	}
+	if err := tfm.readParams(r); err != nil {
+		return nil, err
+	}
+	return &tfm, nil
+}
+
+func (tfm *TFM) readHeader(r io.ReadSeeker) (err error) {
+	if _, err = r.Seek(tfm.tablePointers[Header], io.SeekStart); err != nil {
+		return
+	}
+
+	// Read header[0 ... 1].
+	if tfm.checksum, err = read4bui(r); err != nil {
+		return readError(err, "checksum")
+	}
+	if tfm.designFontSize, err = readFixWord(r); err != nil {
+		return readError(err, "design size")
+	}
+	if tfm.designFontSize < FixWordUnity {
+		return HeaderError{msg: fmt.Sprintf("Design size %v is less than one point", tfm.designFontSize.Float())}
+	}
+
+	// Read header[2 ... 11] if present.
+	position, err := currentPosition(r)
+	if err != nil {
+		return
+	}
+	if tfm.headerDataLengthWords >= characterCodingSchemeHeaderLength {
+		if tfm.characterCodingScheme, err = readBCPL(r); err != nil {
+			return readError(err, "character coding scheme")
+		}
+		if len(tfm.characterCodingScheme) >= CharacterCodingSchemeLength {
+			return HeaderError{msg: fmt.Sprintf("Character coding scheme is %v bytes long, more than %v", len(tfm.characterCodingScheme), CharacterCodingSchemeLength-1)}
+		}
+	}
+
+	// Read header[12 ... 16] if present.
+	position += CharacterCodingSchemeLength
+	if tfm.headerDataLengthWords >= familyHeaderLength {
+		if tfm.family, err = readBCPLFrom(r, position); err != nil {
+			return readError(err, "family")
+		}
+		if len(tfm.family) >= FamilyLength {
+			return HeaderError{msg: fmt.Sprintf("Family is %v bytes long, more than %v", len(tfm.family), FamilyLength-1)}
+		}
+	}
+
+	// Read header[17] if present.
+	position += FamilyLength
+	if tfm.headerDataLengthWords >= faceHeaderLength {
+		flag, err := read1buiFrom(r, position)
+		if err != nil {
+			return readError(err, "seven-bit-safe flag")
+		}
+		tfm.sevenBitSafe = flag >= 128
+		// Unused.
+		if _, err = read2bui(r); err != nil {
+			return readError(err, "header")
+		}
+		face, err := read1bui(r)
+		if err != nil {
+			return readError(err, "face")
+		}
+		tfm.face = Face(face)
+	}
+
+	// Keep the raw header, so that fields we do not interpret survive a
+	// round trip through WriteTo.
+	if _, err = r.Seek(tfm.tablePointers[Header], io.SeekStart); err != nil {
+		return
+	}
+	tfm.header = make([]byte, 4*int(tfm.headerDataLengthWords))
+	if _, err = io.ReadFull(r, tfm.header); err != nil {
+		return readError(err, "header")
+	}
+	return nil
+}
+
+func (tfm *TFM) readCharInfos(r io.ReadSeeker) (err error) {
+	if _, err = r.Seek(tfm.tablePointers[CharacterInfo], io.SeekStart); err != nil {
+		return
+	}
+	nrChars := int(tfm.tableLengthsWords[CharacterInfo])
+	tfm.charInfos = make([]charInfo, nrChars, nrChars)
+	for i := range tfm.charInfos {
+		if tfm.charInfos[i], err = readCharInfo(r); err != nil {
+			return readError(err, "character info")
+		}
+	}
+	return nil
+}
+
+// readFixWordTable reads a whole table whose entries are fix-words.
+func (tfm *TFM) readFixWordTable(r io.ReadSeeker, table Table) (vs []FixWord, err error) {
+	if _, err = r.Seek(tfm.tablePointers[table], io.SeekStart); err != nil {
+		return
+	}
+	n := int(tfm.tableLengthsWords[table])
+	vs = make([]FixWord, n, n)
+	for i := range vs {
+		if vs[i], err = readFixWord(r); err != nil {
+			return nil, readError(err, fmt.Sprintf("%v table", table))
+		}
+	}
+	return
+}
+
+func (tfm *TFM) readParams(r io.ReadSeeker) (err error) {
+	tfm.params, err = tfm.readFixWordTable(r, FontParameter)
+	return
 }
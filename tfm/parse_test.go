@@ -0,0 +1,131 @@
+package tfm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// minimalTFM returns a TFM file with no characters and a header of lh words,
+// the first two of which give a zero checksum and a design size of 10pt.
+func minimalTFM(lh int) []byte {
+	var b bytes.Buffer
+	lf := 6 + lh + 4
+	for _, v := range []int{lf, lh, 1, 0, 1, 1, 1, 1, 0, 0, 0, 0} {
+		binary.Write(&b, binary.BigEndian, uint16(v))
+	}
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, int32(10*FixWordUnity))
+	b.Write(make([]byte, 4*(lh-2)))
+	// The zero entries of the width, height, depth and italic tables.
+	b.Write(make([]byte, 16))
+	return b.Bytes()
+}
+
+func TestLoadErrors(t *testing.T) {
+	put2 := func(bs []byte, i int, v uint16) { binary.BigEndian.PutUint16(bs[2*i:], v) }
+	tests := []struct {
+		name  string
+		patch func(bs []byte) []byte
+		check func(err error) bool
+	}{
+		{"empty", func(bs []byte) []byte {
+			return nil
+		}, isTruncated},
+		{"cut in lengths", func(bs []byte) []byte {
+			return bs[:5]
+		}, isTruncated},
+		{"cut in table lengths", func(bs []byte) []byte {
+			return bs[:20]
+		}, isTruncated},
+		{"cut in tables", func(bs []byte) []byte {
+			return bs[:len(bs)-4]
+		}, isTruncated},
+		{"file length", func(bs []byte) []byte {
+			put2(bs, 0, binary.BigEndian.Uint16(bs)+1)
+			return bs
+		}, isTableLength},
+		{"character range", func(bs []byte) []byte {
+			put2(bs, 2, 'Z')
+			return bs
+		}, isTableLength},
+		{"character beyond 255", func(bs []byte) []byte {
+			put2(bs, 3, 256)
+			return bs
+		}, isTableLength},
+		{"no widths", func(bs []byte) []byte {
+			put2(bs, 4, 0)
+			return bs
+		}, isTableLength},
+		{"no italic corrections", func(bs []byte) []byte {
+			put2(bs, 7, 0)
+			return bs
+		}, isTableLength},
+		{"too many extensibles", func(bs []byte) []byte {
+			put2(bs, 10, 257)
+			return bs
+		}, isTableLength},
+		{"header too short", func(bs []byte) []byte {
+			put2(bs, 1, 1)
+			return bs
+		}, isHeader},
+		{"design size", func(bs []byte) []byte {
+			binary.BigEndian.PutUint32(bs[28:], uint32(FixWordUnity-1))
+			return bs
+		}, isHeader},
+		{"coding scheme length", func(bs []byte) []byte {
+			bs[32] = 40
+			return bs
+		}, isHeader},
+		{"family length", func(bs []byte) []byte {
+			bs[72] = 20
+			return bs
+		}, isHeader},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bs := test.patch(readTestFont(t, "test.tfm"))
+			font, err := Load(bytes.NewReader(bs))
+			if !test.check(err) {
+				t.Errorf("got %v, %T %v", font, err, err)
+			}
+		})
+	}
+}
+
+func isTruncated(err error) bool {
+	_, ok := err.(TruncatedError)
+	return ok
+}
+
+func isTableLength(err error) bool {
+	_, ok := err.(TableLengthError)
+	return ok
+}
+
+func isHeader(err error) bool {
+	_, ok := err.(HeaderError)
+	return ok
+}
+
+func TestLoadShortHeader(t *testing.T) {
+	for _, lh := range []int{2, 11, 12, 17, 18} {
+		bs := minimalTFM(lh)
+		font, err := Load(bytes.NewReader(bs))
+		if err != nil {
+			t.Errorf("header of %v words: %v", lh, err)
+			continue
+		}
+		if font.DesignSize() != 10 || font.Family() != "" || font.CharacterCodingScheme() != "" {
+			t.Errorf("header of %v words: got design size %v, family %q, coding scheme %q",
+				lh, font.DesignSize(), font.Family(), font.CharacterCodingScheme())
+		}
+		var buf bytes.Buffer
+		if _, err := font.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), bs) {
+			t.Errorf("header of %v words: writing the font changed its bytes", lh)
+		}
+	}
+}
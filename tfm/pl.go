@@ -0,0 +1,1153 @@
+package tfm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PLError is returned when a property list cannot be parsed, or describes a
+// font that cannot be encoded as a TFM file.
+type PLError struct {
+	msg string
+}
+
+func (p PLError) Error() string {
+	return p.msg
+}
+
+// Named font parameters, as they appear in a FONTDIMEN list. Parameters
+// eight and up are only named for the math coding schemes.
+var paramNames = map[int]string{
+	1: "SLANT",
+	2: "SPACE",
+	3: "STRETCH",
+	4: "SHRINK",
+	5: "XHEIGHT",
+	6: "QUAD",
+	7: "EXTRASPACE",
+}
+
+var mathSymbolsParamNames = map[int]string{
+	8:  "NUM1",
+	9:  "NUM2",
+	10: "NUM3",
+	11: "DENOM1",
+	12: "DENOM2",
+	13: "SUP1",
+	14: "SUP2",
+	15: "SUP3",
+	16: "SUB1",
+	17: "SUB2",
+	18: "SUPDROP",
+	19: "SUBDROP",
+	20: "DELIM1",
+	21: "DELIM2",
+	22: "AXISHEIGHT",
+}
+
+var mathExtensionParamNames = map[int]string{
+	8:  "DEFAULTRULETHICKNESS",
+	9:  "BIGOPSPACING1",
+	10: "BIGOPSPACING2",
+	11: "BIGOPSPACING3",
+	12: "BIGOPSPACING4",
+	13: "BIGOPSPACING5",
+}
+
+// Property list names of the ligature operations.
+var ligOpPLNames = map[LigOp]string{
+	LigOpReplace:         "LIG",
+	LigOpKeepRight:       "LIG/",
+	LigOpKeepLeft:        "/LIG",
+	LigOpKeepBoth:        "/LIG/",
+	LigOpKeepRightSkip:   "LIG/>",
+	LigOpKeepLeftSkip:    "/LIG>",
+	LigOpKeepBothSkip:    "/LIG/>",
+	LigOpKeepBothSkipTwo: "/LIG/>>",
+}
+
+// Maximum sizes of the dimension tables, including the zero entry.
+const (
+	maxWidths  = 256
+	maxHeights = 16
+	maxDepths  = 16
+	maxItalics = 64
+)
+
+// Properties whose value is the rest of the list, read as a string.
+var plStringProperties = map[string]bool{
+	"FAMILY":       true,
+	"CODINGSCHEME": true,
+	"COMMENT":      true,
+}
+
+// formatFixWord formats a fix-word the way TFtoPL does: with the fewest
+// decimal digits that read back as the same value.
+func formatFixWord(x FixWord) string {
+	var b strings.Builder
+	b.WriteString("R ")
+	// Work on the magnitude, keeping the integer and fraction parts apart.
+	a := int64(x) >> 20
+	f := int64(x) & 0xfffff
+	if a < 0 {
+		b.WriteByte('-')
+		a = -a
+		if f > 0 {
+			f = 0x100000 - f
+			a--
+		}
+	}
+	b.WriteString(strconv.FormatInt(a, 10))
+	b.WriteByte('.')
+	f = 10*f + 5
+	delta := int64(10)
+	for {
+		if delta > 0x100000 {
+			// Round the last digit.
+			f += 0x80000 - 50000
+		}
+		b.WriteByte(byte('0' + f/0x100000))
+		f = 10 * (f % 0x100000)
+		delta *= 10
+		if f <= delta {
+			break
+		}
+	}
+	return b.String()
+}
+
+func isPLLetter(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+// formatPLChar formats a character code as TFtoPL does: as itself if it is
+// a letter or digit, and in octal otherwise.
+func formatPLChar(c byte) string {
+	if isPLLetter(c) {
+		return fmt.Sprintf("C %c", c)
+	}
+	return fmt.Sprintf("O %o", c)
+}
+
+func formatPLFace(face Face) string {
+	if !face.Valid() {
+		return fmt.Sprintf("O %v", face)
+	}
+	return fmt.Sprintf("F %v", face)
+}
+
+type plWriter struct {
+	w     *bufio.Writer
+	depth int
+}
+
+func (p *plWriter) indent() {
+	for i := 0; i < p.depth; i++ {
+		p.w.WriteString("   ")
+	}
+}
+
+// leaf writes a property that has no sub-properties.
+func (p *plWriter) leaf(format string, args ...interface{}) {
+	p.indent()
+	fmt.Fprintf(p.w, "("+format+")\n", args...)
+}
+
+// open starts a property whose sub-properties follow on their own lines.
+func (p *plWriter) open(format string, args ...interface{}) {
+	p.indent()
+	fmt.Fprintf(p.w, "("+format+"\n", args...)
+	p.depth++
+}
+
+func (p *plWriter) close() {
+	p.indent()
+	p.w.WriteString(")\n")
+	p.depth--
+}
+
+// headerWord returns the raw header word at index i, which must exist.
+func (tfm *TFM) headerWord(i int) uint32 {
+	return binary.BigEndian.Uint32(tfm.header[4*i:])
+}
+
+// WritePL writes the font in the property list format of TFtoPL.
+func (tfm *TFM) WritePL(w io.Writer) error {
+	p := &plWriter{w: bufio.NewWriter(w)}
+	if tfm.family != "" {
+		p.leaf("FAMILY %v", tfm.family)
+	}
+	if face, ok := tfm.Face(); ok {
+		p.leaf("FACE %v", formatPLFace(face))
+	}
+	if tfm.characterCodingScheme != "" {
+		p.leaf("CODINGSCHEME %v", tfm.characterCodingScheme)
+	}
+	p.leaf("DESIGNSIZE %v", formatFixWord(tfm.designFontSize))
+	p.leaf("COMMENT DESIGNSIZE IS IN POINTS")
+	p.leaf("COMMENT OTHER SIZES ARE MULTIPLES OF DESIGNSIZE")
+	p.leaf("CHECKSUM O %o", tfm.checksum)
+	if tfm.sevenBitSafe {
+		p.leaf("SEVENBITSAFEFLAG TRUE")
+	}
+	for i := faceHeaderLength; i < len(tfm.header)/4; i++ {
+		p.leaf("HEADER D %d O %o", i, tfm.headerWord(i))
+	}
+
+	if len(tfm.params) > 0 {
+		p.open("FONTDIMEN")
+		for i, v := range tfm.params {
+			if name := tfm.paramName(i + 1); name != "" {
+				p.leaf("%v %v", name, formatFixWord(v))
+			} else {
+				p.leaf("PARAMETER D %d %v", i+1, formatFixWord(v))
+			}
+		}
+		p.close()
+	}
+
+	if tfm.hasBoundaryChar {
+		p.leaf("BOUNDARYCHAR %v", formatPLChar(tfm.boundaryChar))
+	}
+	if err := tfm.writePLLigTable(p); err != nil {
+		return err
+	}
+
+	for code := int(tfm.smallestCharCode); code <= int(tfm.largestCharCode); code++ {
+		if err := tfm.writePLCharacter(p, byte(code)); err != nil {
+			return err
+		}
+	}
+	return p.w.Flush()
+}
+
+// paramName returns the FONTDIMEN name of parameter n, or the empty string
+// if it has none in this font's coding scheme.
+func (tfm *TFM) paramName(n int) string {
+	if name, ok := paramNames[n]; ok {
+		return name
+	}
+	switch tfm.codingSchemeKey() {
+	case mathSymbolsScheme:
+		return mathSymbolsParamNames[n]
+	case mathExtensionScheme, eulerSubstitutionsScheme:
+		return mathExtensionParamNames[n]
+	}
+	return ""
+}
+
+func (tfm *TFM) writePLLigTable(p *plWriter) error {
+	if len(tfm.ligKerns) == 0 {
+		return nil
+	}
+	// Work out which instructions begin the programs of which characters.
+	labels := make(map[int][]byte)
+	for code := int(tfm.smallestCharCode); code <= int(tfm.largestCharCode); code++ {
+		if start := tfm.ligKernStart(byte(code)); start >= 0 {
+			labels[start] = append(labels[start], byte(code))
+		}
+	}
+
+	p.open("LIGTABLE")
+	for i, lk := range tfm.ligKerns {
+		for _, code := range labels[i] {
+			p.leaf("LABEL %v", formatPLChar(code))
+		}
+		if i == tfm.boundaryCharLabel {
+			p.leaf("LABEL BOUNDARYCHAR")
+		}
+		// Instructions beyond the stop flag only redirect to other
+		// instructions, or name boundary characters.
+		if lk.skipByte > stopFlag {
+			continue
+		}
+		if lk.opByte >= kernFlag {
+			k := 256*int(lk.opByte-kernFlag) + int(lk.remainder)
+			if k >= len(tfm.kerns) {
+				return PLError{msg: fmt.Sprintf("Lig/kern instruction %v refers to kern %v, beyond the end of the kern table", i, k)}
+			}
+			p.leaf("KRN %v %v", formatPLChar(lk.nextChar), formatFixWord(tfm.kerns[k]))
+		} else {
+			name, ok := ligOpPLNames[LigOp(lk.opByte)]
+			if !ok {
+				return PLError{msg: fmt.Sprintf("Lig/kern instruction %v has unknown ligature operation %v", i, lk.opByte)}
+			}
+			p.leaf("%v %v %v", name, formatPLChar(lk.nextChar), formatPLChar(lk.remainder))
+		}
+		if lk.skipByte == stopFlag {
+			p.leaf("STOP")
+		} else if lk.skipByte > 0 {
+			p.leaf("SKIP D %d", lk.skipByte)
+		}
+	}
+	p.close()
+	return nil
+}
+
+func (tfm *TFM) writePLCharacter(p *plWriter, code byte) error {
+	ci, ok := tfm.charInfo(code)
+	if !ok {
+		return nil
+	}
+	if int(ci.widthIndex) >= len(tfm.widths) ||
+		int(ci.heightIndex) >= len(tfm.heights) ||
+		int(ci.depthIndex) >= len(tfm.depths) ||
+		int(ci.italicIndex) >= len(tfm.italics) {
+		return PLError{msg: fmt.Sprintf("Character %#o refers beyond the end of a dimension table", code)}
+	}
+	p.open("CHARACTER %v", formatPLChar(code))
+	p.leaf("CHARWD %v", formatFixWord(tfm.widths[ci.widthIndex]))
+	if ci.heightIndex > 0 {
+		p.leaf("CHARHT %v", formatFixWord(tfm.heights[ci.heightIndex]))
+	}
+	if ci.depthIndex > 0 {
+		p.leaf("CHARDP %v", formatFixWord(tfm.depths[ci.depthIndex]))
+	}
+	if ci.italicIndex > 0 {
+		p.leaf("CHARIC %v", formatFixWord(tfm.italics[ci.italicIndex]))
+	}
+	switch ci.tag {
+	case ListTag:
+		p.leaf("NEXTLARGER %v", formatPLChar(ci.remainder))
+	case ExtTag:
+		if int(ci.remainder) >= len(tfm.extensibles) {
+			return PLError{msg: fmt.Sprintf("Character %#o refers beyond the end of the extensible character table", code)}
+		}
+		er := tfm.extensibles[ci.remainder]
+		p.open("VARCHAR")
+		if er.top != 0 {
+			p.leaf("TOP %v", formatPLChar(er.top))
+		}
+		if er.mid != 0 {
+			p.leaf("MID %v", formatPLChar(er.mid))
+		}
+		if er.bot != 0 {
+			p.leaf("BOT %v", formatPLChar(er.bot))
+		}
+		p.leaf("REP %v", formatPLChar(er.rep))
+		p.close()
+	}
+	p.close()
+	return nil
+}
+
+// plNode is a parenthesised property: a name followed by atoms and nested
+// properties. String properties keep their text in raw instead.
+type plNode struct {
+	name  string
+	atoms []string
+	raw   string
+	lists []*plNode
+	line  int
+}
+
+type plParser struct {
+	s    string
+	i    int
+	line int
+}
+
+func (p *plParser) errorf(format string, args ...interface{}) error {
+	return PLError{msg: fmt.Sprintf("Line %v: ", p.line) + fmt.Sprintf(format, args...)}
+}
+
+func (p *plParser) skipSpace() {
+	for p.i < len(p.s) {
+		switch p.s[p.i] {
+		case '\n':
+			p.line++
+		case ' ', '\t', '\r', '\f':
+		default:
+			return
+		}
+		p.i++
+	}
+}
+
+func (p *plParser) atom() string {
+	start := p.i
+	for p.i < len(p.s) && !strings.ContainsRune(" \t\r\n\f()", rune(p.s[p.i])) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// parseList parses a property, starting at its opening parenthesis.
+func (p *plParser) parseList() (*plNode, error) {
+	p.i++
+	p.skipSpace()
+	node := &plNode{name: strings.ToUpper(p.atom()), line: p.line}
+	if node.name == "" {
+		return nil, p.errorf("Property has no name")
+	}
+	if plStringProperties[node.name] {
+		start := p.i
+		for depth := 0; ; p.i++ {
+			if p.i >= len(p.s) {
+				return nil, p.errorf("File ended inside %v", node.name)
+			}
+			switch p.s[p.i] {
+			case '\n':
+				p.line++
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth < 0 {
+				break
+			}
+		}
+		node.raw = strings.TrimSpace(p.s[start:p.i])
+		p.i++
+		return node, nil
+	}
+	for {
+		p.skipSpace()
+		if p.i >= len(p.s) {
+			return nil, p.errorf("File ended inside %v", node.name)
+		}
+		switch p.s[p.i] {
+		case ')':
+			p.i++
+			return node, nil
+		case '(':
+			child, err := p.parseList()
+			if err != nil {
+				return nil, err
+			}
+			node.lists = append(node.lists, child)
+		default:
+			node.atoms = append(node.atoms, p.atom())
+		}
+	}
+}
+
+func parsePLNodes(s string) (nodes []*plNode, err error) {
+	p := &plParser{s: s, line: 1}
+	for {
+		p.skipSpace()
+		if p.i >= len(p.s) {
+			return
+		}
+		if p.s[p.i] != '(' {
+			return nil, p.errorf("Expected '(', found %q", p.atom())
+		}
+		node, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+// parseFix converts a decimal number to the nearest fix-word, as PLtoTF
+// does.
+func parseFix(s string) (FixWord, error) {
+	negative := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return 0, PLError{msg: fmt.Sprintf("Bad real number %q", s)}
+	}
+	var whole int64
+	for _, c := range intPart {
+		if c < '0' || c > '9' {
+			return 0, PLError{msg: fmt.Sprintf("Bad real number %q", s)}
+		}
+		whole = 10*whole + int64(c-'0')
+		if whole > 2048 {
+			break
+		}
+	}
+	// Only the first seven fraction digits are significant.
+	var digits []int64
+	for _, c := range fracPart {
+		if c < '0' || c > '9' {
+			return 0, PLError{msg: fmt.Sprintf("Bad real number %q", s)}
+		}
+		if len(digits) < 7 {
+			digits = append(digits, int64(c-'0')<<21)
+		}
+	}
+	var frac int64
+	for k := len(digits) - 1; k >= 0; k-- {
+		frac = (frac + digits[k]) / 10
+	}
+	frac = (frac + 1) / 2
+	// As in PLtoTF, the magnitude must be less than 2048, so -2048 is
+	// rejected even though it would fit in a fix-word.
+	bits := whole<<20 + frac
+	if bits > math.MaxInt32 {
+		return 0, PLError{msg: fmt.Sprintf("Real number %q is not less than 2048 in magnitude", s)}
+	}
+	if negative {
+		bits = -bits
+	}
+	return FixWord(bits), nil
+}
+
+func parsePLFace(s string) (byte, error) {
+	if len(s) != 3 {
+		return 0, PLError{msg: fmt.Sprintf("Bad face code %q", s)}
+	}
+	w := strings.IndexByte(faceWeights, s[0])
+	sl := strings.IndexByte(faceSlopes, s[1])
+	e := strings.IndexByte(faceExpansions, s[2])
+	if w < 0 || sl < 0 || e < 0 {
+		return 0, PLError{msg: fmt.Sprintf("Bad face code %q", s)}
+	}
+	return byte(NewFace(Weight(w), Slope(sl), Expansion(e))), nil
+}
+
+// plInt reads an integer written with a C, D, O, H or F prefix from the
+// start of atoms, and returns it with the atoms that follow it.
+func plInt(node *plNode, atoms []string) (v uint32, rest []string, err error) {
+	if len(atoms) < 2 {
+		return 0, nil, PLError{msg: fmt.Sprintf("Line %v: %v is missing a number", node.line, node.name)}
+	}
+	prefix, s := strings.ToUpper(atoms[0]), atoms[1]
+	var x uint64
+	switch prefix {
+	case "C":
+		if len(s) != 1 {
+			err = PLError{msg: fmt.Sprintf("Line %v: %q is not a single character", node.line, s)}
+		}
+		x = uint64(s[0])
+	case "D":
+		x, err = strconv.ParseUint(s, 10, 32)
+	case "O":
+		x, err = strconv.ParseUint(s, 8, 32)
+	case "H":
+		x, err = strconv.ParseUint(s, 16, 32)
+	case "F":
+		var f byte
+		f, err = parsePLFace(strings.ToUpper(s))
+		x = uint64(f)
+	default:
+		err = PLError{msg: fmt.Sprintf("Line %v: Unknown number prefix %q", node.line, atoms[0])}
+	}
+	if err != nil {
+		if _, ok := err.(PLError); !ok {
+			err = PLError{msg: fmt.Sprintf("Line %v: Bad number %q: %v", node.line, s, err)}
+		}
+		return
+	}
+	return uint32(x), atoms[2:], nil
+}
+
+// plByte reads an integer that must fit in a byte, such as a character code.
+func plByte(node *plNode, atoms []string) (v byte, rest []string, err error) {
+	x, rest, err := plInt(node, atoms)
+	if err == nil && x > 255 {
+		err = PLError{msg: fmt.Sprintf("Line %v: %v is too big for a byte", node.line, x)}
+	}
+	return byte(x), rest, err
+}
+
+// plReal reads a real number from the start of atoms.
+func plReal(node *plNode, atoms []string) (v FixWord, rest []string, err error) {
+	if len(atoms) < 2 || (strings.ToUpper(atoms[0]) != "R" && strings.ToUpper(atoms[0]) != "D") {
+		return 0, nil, PLError{msg: fmt.Sprintf("Line %v: %v is missing a real number", node.line, node.name)}
+	}
+	v, err = parseFix(atoms[1])
+	if err != nil {
+		return 0, nil, PLError{msg: fmt.Sprintf("Line %v: %v", node.line, err)}
+	}
+	return v, atoms[2:], nil
+}
+
+// dimension reads a real number that is given in design units, and converts
+// it to a multiple of the design size.
+func (b *plBuilder) dimension(node *plNode, atoms []string) (v FixWord, rest []string, err error) {
+	v, rest, err = plReal(node, atoms)
+	if err == nil && b.designUnits != FixWordUnity {
+		v = FixWord(math.Round(float64(v) * float64(FixWordUnity) / float64(b.designUnits)))
+	}
+	return
+}
+
+type plChar struct {
+	width  FixWord
+	height FixWord
+	depth  FixWord
+	italic FixWord
+	tag    Tag
+	// The next larger character, or index into extensibles.
+	remainder byte
+}
+
+// plBuilder accumulates the properties of a font as a property list is
+// read.
+type plBuilder struct {
+	designUnits     FixWord
+	designSize      FixWord
+	checksum        uint32
+	hasChecksum     bool
+	codingScheme    string
+	family          string
+	face            byte
+	sevenBitSafe    bool
+	extraHeader     map[int]uint32
+	params          []FixWord
+	boundaryChar    byte
+	hasBoundaryChar bool
+
+	chars       [256]*plChar
+	extensibles []extensibleRecipe
+
+	ligKerns      []ligKernInstruction
+	labels        map[byte]int
+	boundaryLabel int
+	kerns         []FixWord
+	kernIndices   map[FixWord]int
+}
+
+// ParsePL reads a font in the property list format used by TFtoPL and
+// PLtoTF. Unlike PLtoTF, it does not round dimensions to make them fit in the
+// TFM tables; a font with too many different heights, say, is an error.
+func ParsePL(r io.Reader) (*TFM, error) {
+	bs, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := parsePLNodes(string(bs))
+	if err != nil {
+		return nil, err
+	}
+	b := &plBuilder{
+		designUnits:   FixWordUnity,
+		designSize:    10 * FixWordUnity,
+		extraHeader:   make(map[int]uint32),
+		labels:        make(map[byte]int),
+		boundaryLabel: -1,
+		kernIndices:   make(map[FixWord]int),
+	}
+	for _, node := range nodes {
+		if err := b.property(node); err != nil {
+			return nil, err
+		}
+	}
+	tfm, err := b.build()
+	if err != nil {
+		return nil, err
+	}
+	// Going through the binary form fills in everything that Load derives
+	// from the tables.
+	var buf bytes.Buffer
+	if _, err := tfm.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return Load(bytes.NewReader(buf.Bytes()))
+}
+
+func (b *plBuilder) property(node *plNode) (err error) {
+	errorf := func(format string, args ...interface{}) error {
+		return PLError{msg: fmt.Sprintf("Line %v: ", node.line) + fmt.Sprintf(format, args...)}
+	}
+	switch node.name {
+	case "COMMENT":
+	case "FAMILY":
+		if len(node.raw) >= FamilyLength {
+			return errorf("Family is longer than %v characters", FamilyLength-1)
+		}
+		b.family = node.raw
+	case "CODINGSCHEME":
+		if len(node.raw) >= CharacterCodingSchemeLength {
+			return errorf("Coding scheme is longer than %v characters", CharacterCodingSchemeLength-1)
+		}
+		b.codingScheme = node.raw
+	case "FACE":
+		b.face, _, err = plByte(node, node.atoms)
+	case "DESIGNSIZE":
+		b.designSize, _, err = plReal(node, node.atoms)
+		if err == nil && b.designSize < FixWordUnity {
+			return errorf("Design size must be at least 1")
+		}
+	case "DESIGNUNITS":
+		b.designUnits, _, err = plReal(node, node.atoms)
+		if err == nil && b.designUnits <= 0 {
+			return errorf("Design units must be positive")
+		}
+	case "CHECKSUM":
+		b.checksum, _, err = plInt(node, node.atoms)
+		b.hasChecksum = true
+	case "SEVENBITSAFEFLAG":
+		b.sevenBitSafe = len(node.atoms) > 0 && strings.ToUpper(node.atoms[0]) == "TRUE"
+	case "HEADER":
+		var i, v uint32
+		var rest []string
+		if i, rest, err = plInt(node, node.atoms); err != nil {
+			return
+		}
+		if i < faceHeaderLength || i > math.MaxUint16 {
+			return errorf("HEADER index %v must be at least %v", i, faceHeaderLength)
+		}
+		if v, _, err = plInt(node, rest); err != nil {
+			return
+		}
+		b.extraHeader[int(i)] = v
+	case "FONTDIMEN":
+		for _, child := range node.lists {
+			if err = b.fontDimen(child); err != nil {
+				return
+			}
+		}
+	case "BOUNDARYCHAR":
+		b.boundaryChar, _, err = plByte(node, node.atoms)
+		b.hasBoundaryChar = true
+	case "LIGTABLE":
+		for _, child := range node.lists {
+			if err = b.ligTableEntry(child); err != nil {
+				return
+			}
+		}
+	case "CHARACTER":
+		err = b.character(node)
+	default:
+		return errorf("Unknown property %v", node.name)
+	}
+	return
+}
+
+func (b *plBuilder) fontDimen(node *plNode) error {
+	if node.name == "COMMENT" {
+		return nil
+	}
+	n := 0
+	atoms := node.atoms
+	if node.name == "PARAMETER" {
+		i, rest, err := plInt(node, atoms)
+		if err != nil {
+			return err
+		}
+		if i < 1 || i > math.MaxUint16 {
+			return PLError{msg: fmt.Sprintf("Line %v: Bad parameter number %v", node.line, i)}
+		}
+		n, atoms = int(i), rest
+	} else {
+		for _, names := range []map[int]string{paramNames, mathSymbolsParamNames, mathExtensionParamNames} {
+			for i, name := range names {
+				if name == node.name {
+					n = i
+				}
+			}
+		}
+		if n == 0 {
+			return PLError{msg: fmt.Sprintf("Line %v: Unknown font dimension %v", node.line, node.name)}
+		}
+	}
+	// The slant is a pure number, so is not in design units.
+	read := b.dimension
+	if n == 1 {
+		read = plReal
+	}
+	v, _, err := read(node, atoms)
+	if err != nil {
+		return err
+	}
+	for len(b.params) < n {
+		b.params = append(b.params, 0)
+	}
+	b.params[n-1] = v
+	return nil
+}
+
+func (b *plBuilder) ligTableEntry(node *plNode) error {
+	errorf := func(format string, args ...interface{}) error {
+		return PLError{msg: fmt.Sprintf("Line %v: ", node.line) + fmt.Sprintf(format, args...)}
+	}
+	last := len(b.ligKerns) - 1
+	switch node.name {
+	case "COMMENT":
+	case "LABEL":
+		if len(node.atoms) == 1 && strings.ToUpper(node.atoms[0]) == "BOUNDARYCHAR" {
+			b.boundaryLabel = len(b.ligKerns)
+			return nil
+		}
+		c, _, err := plByte(node, node.atoms)
+		if err != nil {
+			return err
+		}
+		b.labels[c] = len(b.ligKerns)
+	case "STOP":
+		if last < 0 {
+			return errorf("STOP must follow an instruction")
+		}
+		b.ligKerns[last].skipByte = stopFlag
+	case "SKIP":
+		if last < 0 {
+			return errorf("SKIP must follow an instruction")
+		}
+		n, _, err := plInt(node, node.atoms)
+		if err != nil {
+			return err
+		}
+		if n >= stopFlag {
+			return errorf("Cannot skip %v instructions", n)
+		}
+		b.ligKerns[last].skipByte = uint8(n)
+	case "KRN":
+		c, rest, err := plByte(node, node.atoms)
+		if err != nil {
+			return err
+		}
+		v, _, err := b.dimension(node, rest)
+		if err != nil {
+			return err
+		}
+		k, ok := b.kernIndices[v]
+		if !ok {
+			k = len(b.kerns)
+			if k >= 256*(256-kernFlag) {
+				return errorf("Too many different kerns")
+			}
+			b.kerns = append(b.kerns, v)
+			b.kernIndices[v] = k
+		}
+		b.ligKerns = append(b.ligKerns, ligKernInstruction{
+			nextChar:  c,
+			opByte:    uint8(kernFlag + k/256),
+			remainder: uint8(k % 256),
+		})
+	default:
+		op, ok := LigOp(0), false
+		for o, name := range ligOpPLNames {
+			if name == node.name {
+				op, ok = o, true
+			}
+		}
+		if !ok {
+			return errorf("Unknown lig/kern instruction %v", node.name)
+		}
+		next, rest, err := plByte(node, node.atoms)
+		if err != nil {
+			return err
+		}
+		lig, _, err := plByte(node, rest)
+		if err != nil {
+			return err
+		}
+		b.ligKerns = append(b.ligKerns, ligKernInstruction{nextChar: next, opByte: uint8(op), remainder: lig})
+	}
+	return nil
+}
+
+func (b *plBuilder) character(node *plNode) error {
+	code, _, err := plByte(node, node.atoms)
+	if err != nil {
+		return err
+	}
+	c := &plChar{}
+	setTag := func(child *plNode, tag Tag, remainder byte) error {
+		if c.tag != NoTag {
+			return PLError{msg: fmt.Sprintf("Line %v: Character %#o is already in a charlist or extensible", child.line, code)}
+		}
+		c.tag, c.remainder = tag, remainder
+		return nil
+	}
+	for _, child := range node.lists {
+		switch child.name {
+		case "COMMENT":
+		case "CHARWD":
+			c.width, _, err = b.dimension(child, child.atoms)
+		case "CHARHT":
+			c.height, _, err = b.dimension(child, child.atoms)
+		case "CHARDP":
+			c.depth, _, err = b.dimension(child, child.atoms)
+		case "CHARIC":
+			c.italic, _, err = b.dimension(child, child.atoms)
+		case "NEXTLARGER":
+			var next byte
+			if next, _, err = plByte(child, child.atoms); err == nil {
+				err = setTag(child, ListTag, next)
+			}
+		case "VARCHAR":
+			var er extensibleRecipe
+			for _, piece := range child.lists {
+				var v byte
+				if v, _, err = plByte(piece, piece.atoms); err != nil {
+					return err
+				}
+				switch piece.name {
+				case "TOP":
+					er.top = v
+				case "MID":
+					er.mid = v
+				case "BOT":
+					er.bot = v
+				case "REP":
+					er.rep = v
+				case "COMMENT":
+				default:
+					return PLError{msg: fmt.Sprintf("Line %v: Unknown extensible piece %v", piece.line, piece.name)}
+				}
+			}
+			if len(b.extensibles) >= 256 {
+				return PLError{msg: fmt.Sprintf("Line %v: Too many extensible characters", child.line)}
+			}
+			err = setTag(child, ExtTag, byte(len(b.extensibles)))
+			b.extensibles = append(b.extensibles, er)
+		default:
+			return PLError{msg: fmt.Sprintf("Line %v: Unknown character property %v", child.line, child.name)}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	b.chars[code] = c
+	return nil
+}
+
+// buildDimensionTable collects the distinct values of a dimension into a
+// table whose entry zero is zero. Characters whose value is zero use entry
+// zero, unless allowZeroEntry is false, as for widths, where entry zero means
+// the character does not exist.
+func buildDimensionTable(values []FixWord, max int, allowZeroEntry bool, what string) (table []FixWord, index map[FixWord]uint8, err error) {
+	var distinct []FixWord
+	seen := make(map[FixWord]bool)
+	for _, v := range values {
+		if (v != 0 || !allowZeroEntry) && !seen[v] {
+			seen[v] = true
+			distinct = append(distinct, v)
+		}
+	}
+	if len(distinct)+1 > max {
+		return nil, nil, PLError{msg: fmt.Sprintf("Font has %v different %v, but at most %v are allowed", len(distinct), what, max-1)}
+	}
+	sort.Slice(distinct, func(i, j int) bool { return distinct[i] < distinct[j] })
+	table = append([]FixWord{0}, distinct...)
+	index = make(map[FixWord]uint8)
+	for i, v := range distinct {
+		index[v] = uint8(i + 1)
+	}
+	if allowZeroEntry {
+		index[0] = 0
+	}
+	return
+}
+
+// computeChecksum computes the checksum PLtoTF gives a font that does not
+// specify one, from its character codes and widths.
+func computeChecksum(bc, ec int, chars [256]*plChar) uint32 {
+	c0, c1, c2, c3 := int64(bc), int64(ec), int64(bc), int64(ec)
+	for code := bc; code <= ec; code++ {
+		if chars[code] == nil {
+			continue
+		}
+		x := int64(chars[code].width) + int64(code+4)*0x400000
+		c0 = (c0 + c0 + x) % 255
+		c1 = (c1 + c1 + x) % 253
+		c2 = (c2 + c2 + x) % 251
+		c3 = (c3 + c3 + x) % 247
+	}
+	return uint32(c0)<<24 | uint32(c1)<<16 | uint32(c2)<<8 | uint32(c3)
+}
+
+// buildLigKerns lays out the lig/kern table, adding instructions at the start
+// for the boundary character and for programs that begin beyond location
+// 255, and one at the end for the boundary program. It returns the table and
+// the remainder for each labelled character.
+func (b *plBuilder) buildLigKerns() (ligKerns []ligKernInstruction, remainders map[byte]uint8, err error) {
+	instructions := append([]ligKernInstruction(nil), b.ligKerns...)
+	if n := len(instructions); n > 0 && instructions[n-1].skipByte < stopFlag {
+		instructions[n-1].skipByte = stopFlag
+	}
+
+	var targets []int
+	seen := make(map[int]bool)
+	for _, target := range b.labels {
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(targets)))
+
+	// The boundary character needs a location of its own at the start,
+	// unless that can double as a redirection.
+	offset := 0
+	extraLocation := b.hasBoundaryChar
+	if extraLocation {
+		offset = 1
+	}
+	redirections := make(map[int]int)
+	if len(targets) > 0 && targets[0]+offset > 255 {
+		offset, extraLocation = 0, false
+		for i := 0; ; {
+			redirections[targets[i]] = offset
+			offset++
+			i++
+			if i == len(targets) || targets[i]+offset < 256 {
+				break
+			}
+		}
+		if offset > 256 {
+			return nil, nil, PLError{msg: "Lig/kern table is too long"}
+		}
+	}
+
+	if extraLocation {
+		ligKerns = append(ligKerns, ligKernInstruction{skipByte: boundaryFlag, nextChar: b.boundaryChar})
+	}
+	slots := make([]int, len(redirections))
+	for target, slot := range redirections {
+		slots[slot] = target
+	}
+	for slot, target := range slots {
+		lk := ligKernInstruction{
+			skipByte:  stopFlag + 1,
+			opByte:    uint8((target + offset) >> 8),
+			remainder: uint8(target + offset),
+		}
+		if slot == 0 && b.hasBoundaryChar {
+			lk.skipByte = boundaryFlag
+			lk.nextChar = b.boundaryChar
+		}
+		ligKerns = append(ligKerns, lk)
+	}
+	ligKerns = append(ligKerns, instructions...)
+	if b.boundaryLabel >= 0 {
+		target := b.boundaryLabel + offset
+		ligKerns = append(ligKerns, ligKernInstruction{
+			skipByte:  boundaryFlag,
+			opByte:    uint8(target >> 8),
+			remainder: uint8(target),
+		})
+	}
+	if len(ligKerns) > math.MaxUint16 {
+		return nil, nil, PLError{msg: "Lig/kern table is too long"}
+	}
+
+	remainders = make(map[byte]uint8)
+	for code, target := range b.labels {
+		if slot, ok := redirections[target]; ok {
+			remainders[code] = uint8(slot)
+		} else {
+			remainders[code] = uint8(target + offset)
+		}
+	}
+	return ligKerns, remainders, nil
+}
+
+func (b *plBuilder) build() (*TFM, error) {
+	bc, ec := 256, -1
+	var widths, heights, depths, italics []FixWord
+	for code, c := range b.chars {
+		if c == nil {
+			continue
+		}
+		if code < bc {
+			bc = code
+		}
+		ec = code
+		widths = append(widths, c.width)
+		heights = append(heights, c.height)
+		depths = append(depths, c.depth)
+		italics = append(italics, c.italic)
+	}
+	if ec < 0 {
+		// By convention, a font with no characters has bc = 1 and ec = 0.
+		bc, ec = 1, 0
+	}
+	widthTable, widthIndex, err := buildDimensionTable(widths, maxWidths, false, "widths")
+	if err != nil {
+		return nil, err
+	}
+	heightTable, heightIndex, err := buildDimensionTable(heights, maxHeights, true, "heights")
+	if err != nil {
+		return nil, err
+	}
+	depthTable, depthIndex, err := buildDimensionTable(depths, maxDepths, true, "depths")
+	if err != nil {
+		return nil, err
+	}
+	italicTable, italicIndex, err := buildDimensionTable(italics, maxItalics, true, "italic corrections")
+	if err != nil {
+		return nil, err
+	}
+
+	ligKerns, remainders, err := b.buildLigKerns()
+	if err != nil {
+		return nil, err
+	}
+	for code := range remainders {
+		if b.chars[code] == nil {
+			return nil, PLError{msg: fmt.Sprintf("Lig/kern program labelled for character %#o, which is not in the font", code)}
+		}
+	}
+
+	charInfos := make([]charInfo, ec+1-bc)
+	for i := range charInfos {
+		code := byte(bc + i)
+		c := b.chars[code]
+		if c == nil {
+			continue
+		}
+		ci := charInfo{
+			widthIndex:  widthIndex[c.width],
+			heightIndex: heightIndex[c.height],
+			depthIndex:  depthIndex[c.depth],
+			italicIndex: italicIndex[c.italic],
+			tag:         c.tag,
+			remainder:   c.remainder,
+		}
+		if rem, ok := remainders[code]; ok {
+			if c.tag != NoTag {
+				return nil, PLError{msg: fmt.Sprintf("Character %#o has a lig/kern program, but is also in a charlist or extensible", code)}
+			}
+			ci.tag, ci.remainder = LigTag, rem
+		}
+		charInfos[i] = ci
+	}
+
+	if !b.hasChecksum {
+		b.checksum = computeChecksum(bc, ec, b.chars)
+	}
+	lh := faceHeaderLength
+	for i := range b.extraHeader {
+		if i+1 > lh {
+			lh = i + 1
+		}
+	}
+	header := make([]byte, 4*lh)
+	for i, v := range b.extraHeader {
+		binary.BigEndian.PutUint32(header[4*i:], v)
+	}
+
+	return &TFM{
+		headerDataLengthWords: uint16(lh),
+		smallestCharCode:      uint16(bc),
+		largestCharCode:       uint16(ec),
+		checksum:              b.checksum,
+		designFontSize:        b.designSize,
+		characterCodingScheme: b.codingScheme,
+		family:                b.family,
+		sevenBitSafe:          b.sevenBitSafe,
+		face:                  Face(b.face),
+		header:                header,
+		charInfos:             charInfos,
+		widths:                widthTable,
+		heights:               heightTable,
+		depths:                depthTable,
+		italics:               italicTable,
+		ligKerns:              ligKerns,
+		kerns:                 b.kerns,
+		extensibles:           b.extensibles,
+		params:                b.params,
+	}, nil
+}
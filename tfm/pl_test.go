@@ -0,0 +1,183 @@
+package tfm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testMathPL is testdata/math.tfm as a property list.
+const testMathPL = `(FAMILY CMEX)
+(CODINGSCHEME TeX math extension)
+(DESIGNSIZE R 10.0)
+(CHECKSUM O 1234567)
+(BOUNDARYCHAR C A)
+(FONTDIMEN
+   (SLANT R 0.25)
+   (SPACE R 0.0)
+   (STRETCH R 0.0)
+   (SHRINK R 0.0)
+   (XHEIGHT R 0.430555)
+   (QUAD R 1.0)
+   (EXTRASPACE R 0.0)
+   (PARAMETER D 8 R 0.04)
+   (PARAMETER D 9 R 0.111111)
+   )
+(LIGTABLE
+   (LABEL C A)
+   (LABEL BOUNDARYCHAR)
+   (KRN C B R 0.1)
+   (SKIP D 1)
+   (KRN C A R -0.1)
+   (LIG/ C B C A)
+   (STOP)
+   )
+(CHARACTER C A
+   (CHARWD R 0.5)
+   (CHARHT R 0.04)
+   (CHARDP R 0.56)
+   )
+(CHARACTER C B
+   (CHARWD R 0.875)
+   (CHARDP R 1.2)
+   (VARCHAR
+      (TOP C A)
+      (REP C A)
+      )
+   )
+`
+
+func TestParsePL(t *testing.T) {
+	tests := []struct {
+		pl   string
+		font string
+	}{
+		{testPL, "test.tfm"},
+		{testMathPL, "math.tfm"},
+	}
+	for _, test := range tests {
+		font, err := ParsePL(strings.NewReader(test.pl))
+		if err != nil {
+			t.Fatalf("%v: %v", test.font, err)
+		}
+		var buf bytes.Buffer
+		if _, err := font.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), readTestFont(t, test.font)) {
+			t.Errorf("%v: the property list does not give the same bytes", test.font)
+		}
+	}
+}
+
+func TestPLRoundTrip(t *testing.T) {
+	for _, name := range testFonts {
+		bs := readTestFont(t, name)
+		font, err := Load(bytes.NewReader(bs))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// TFM to PL to TFM.
+		var pl bytes.Buffer
+		if err := font.WritePL(&pl); err != nil {
+			t.Fatal(err)
+		}
+		reparsed, err := ParsePL(bytes.NewReader(pl.Bytes()))
+		if err != nil {
+			t.Fatalf("%v: %v parsing\n%s", name, err, pl.Bytes())
+		}
+		var again bytes.Buffer
+		if _, err := reparsed.WriteTo(&again); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again.Bytes(), bs) {
+			t.Errorf("%v: converting to PL and back changed its bytes", name)
+		}
+
+		// PL to TFM to PL.
+		var plAgain bytes.Buffer
+		if err := reparsed.WritePL(&plAgain); err != nil {
+			t.Fatal(err)
+		}
+		if plAgain.String() != pl.String() {
+			t.Errorf("%v: got PL\n%v\nwant\n%v", name, plAgain.String(), pl.String())
+		}
+	}
+}
+
+func TestWritePL(t *testing.T) {
+	font, err := Load(bytes.NewReader(readTestFont(t, "test.tfm")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := font.WritePL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != testPL {
+		t.Errorf("got\n%v\nwant\n%v", buf.String(), testPL)
+	}
+}
+
+func TestParseFix(t *testing.T) {
+	tests := []struct {
+		s    string
+		want FixWord
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"1", FixWordUnity, true},
+		{"-1", -FixWordUnity, true},
+		{"+.5", FixWordUnity / 2, true},
+		{"0.25", FixWordUnity / 4, true},
+		// Digits past the seventh are ignored.
+		{"0.00000049", 0, true},
+		{"0.0000005", 1, true},
+		{"2047.9999995", 2047*FixWordUnity + (FixWordUnity - 1), true},
+		{"-2047.9999995", -2047*FixWordUnity - (FixWordUnity - 1), true},
+		// Magnitudes of 2048 or more are rejected, -2048 included.
+		{"2048", 0, false},
+		{"-2048", 0, false},
+		{"2047.9999999", 0, false},
+		{"-2047.9999999", 0, false},
+		{"100000", 0, false},
+		{"", 0, false},
+		{".", 0, false},
+		{"1.2.3", 0, false},
+		{"x", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseFix(test.s)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("%q: got %v, %v, want %v, ok %v", test.s, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestParsePLDesignUnits(t *testing.T) {
+	font := loadPL(t, `(DESIGNSIZE R 10.0)
+(DESIGNUNITS R 1000)
+(FONTDIMEN
+   (SLANT R 0.25)
+   (SPACE R 250)
+   (PARAMETER D 9 R 500)
+   )
+(CHARACTER C A
+   (CHARWD R 500)
+   (CHARHT R -250)
+   )
+`)
+	if got := font.Slant(); got != FixWordUnity/4 {
+		t.Errorf("got slant %v, want %v, as the slant is not in design units", got, FixWordUnity/4)
+	}
+	if got := font.Space(); got != FixWordUnity/4 {
+		t.Errorf("got space %v, want %v", got, FixWordUnity/4)
+	}
+	if got, _ := font.Param(9); got != FixWordUnity/2 {
+		t.Errorf("got parameter 9 %v, want %v", got, FixWordUnity/2)
+	}
+	if w, h, _, _, _ := font.CharDimensions('A'); w != FixWordUnity/2 || h != -FixWordUnity/4 {
+		t.Errorf("got width %v and height %v, want %v and %v", w, h, FixWordUnity/2, -FixWordUnity/4)
+	}
+}
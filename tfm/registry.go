@@ -0,0 +1,166 @@
+package tfm
+
+import (
+	"sync"
+)
+
+// RegistryStats counts the requests a FontRegistry has served.
+type RegistryStats struct {
+	// Hits counts instances served from the registry, including those whose
+	// creation was already under way for another caller.
+	Hits int
+	// Misses counts instances the registry had to create.
+	Misses int
+	// TFMHits counts requests for the metrics of a font, whether for
+	// themselves or to make an instance, that were served from a font
+	// already loaded or being loaded.
+	TFMHits int
+	// Loads counts TFM files loaded, successfully or not, which are the
+	// requests for metrics that were not hits.
+	Loads int
+}
+
+type fontEntry struct {
+	done chan struct{}
+	tfm  *TFM
+	err  error
+}
+
+type instanceKey struct {
+	name string
+	size Scaled
+}
+
+type instanceEntry struct {
+	done chan struct{}
+	fi   *FontInstance
+	err  error
+}
+
+// FontRegistry hands out font instances by name and size, loading each TFM
+// file once however many instances are made from it, and making each
+// instance once however often it is asked for. Callers asking for a font
+// that is already being loaded wait for that load instead of starting their
+// own. A FontRegistry is safe for concurrent use.
+//
+// Each caller gets its own clone of an instance or TFM, so setting its
+// parameters does not affect other callers.
+type FontRegistry struct {
+	load func(name string) (*TFM, error)
+
+	mu        sync.Mutex
+	fonts     map[string]*fontEntry
+	instances map[instanceKey]*instanceEntry
+	stats     RegistryStats
+}
+
+// NewFontRegistry returns a FontRegistry that loads fonts by name with load,
+// such as a FontFinder's LoadFont method. Failed loads are not remembered,
+// so a font that failed to load is tried again the next time it is asked
+// for, and neither are instances that could not be made.
+func NewFontRegistry(load func(name string) (*TFM, error)) *FontRegistry {
+	return &FontRegistry{
+		load:      load,
+		fonts:     make(map[string]*fontEntry),
+		instances: make(map[instanceKey]*instanceEntry),
+	}
+}
+
+// Stats returns the counts of requests served so far.
+func (r *FontRegistry) Stats() RegistryStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// TFM returns the metrics of the font name, loading them if this is the
+// first time they are asked for.
+func (r *FontRegistry) TFM(name string) (*TFM, error) {
+	t, err := r.tfm(name)
+	if err != nil {
+		return nil, err
+	}
+	return t.Clone(), nil
+}
+
+// tfm returns the shared metrics of the font name, which instances are made
+// from.
+func (r *FontRegistry) tfm(name string) (*TFM, error) {
+	r.mu.Lock()
+	if e, ok := r.fonts[name]; ok {
+		r.stats.TFMHits++
+		r.mu.Unlock()
+		<-e.done
+		return e.tfm, e.err
+	}
+	e := &fontEntry{done: make(chan struct{})}
+	r.fonts[name] = e
+	r.stats.Loads++
+	r.mu.Unlock()
+
+	e.tfm, e.err = r.load(name)
+	if e.err != nil {
+		r.mu.Lock()
+		delete(r.fonts, name)
+		r.mu.Unlock()
+	}
+	close(e.done)
+	return e.tfm, e.err
+}
+
+// At returns an instance of the font name at the given size, as for
+// \font\x=name at size.
+func (r *FontRegistry) At(name string, size Scaled) (*FontInstance, error) {
+	t, err := r.tfm(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.at(name, t, size)
+}
+
+// at returns an instance of the font name, whose metrics are t, at the
+// given size.
+func (r *FontRegistry) at(name string, t *TFM, size Scaled) (*FontInstance, error) {
+	key := instanceKey{name: name, size: size}
+	r.mu.Lock()
+	if e, ok := r.instances[key]; ok {
+		r.stats.Hits++
+		r.mu.Unlock()
+		<-e.done
+		if e.err != nil {
+			return nil, e.err
+		}
+		return e.fi.Clone(), nil
+	}
+	e := &instanceEntry{done: make(chan struct{})}
+	r.instances[key] = e
+	r.stats.Misses++
+	r.mu.Unlock()
+
+	e.fi, e.err = t.At(size)
+	if e.err != nil {
+		r.mu.Lock()
+		delete(r.instances, key)
+		r.mu.Unlock()
+	}
+	close(e.done)
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.fi.Clone(), nil
+}
+
+// Scaled returns an instance of the font name at its design size magnified
+// by n/1000, as for \font\x=name scaled n. It is the same instance as At
+// gives for the size that works out to.
+func (r *FontRegistry) Scaled(name string, n int) (*FontInstance, error) {
+	t, err := r.tfm(name)
+	if err != nil {
+		return nil, err
+	}
+	size, err := t.scaledSize(n)
+	if err != nil {
+		return nil, err
+	}
+	return r.at(name, t, size)
+}
@@ -0,0 +1,98 @@
+package tfm
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func testRegistry(t *testing.T) *FontRegistry {
+	bs := testTFM(t)
+	return NewFontRegistry(func(name string) (*TFM, error) {
+		if name != "cmr10" {
+			return nil, errors.New("no such font")
+		}
+		return Load(bytes.NewReader(bs))
+	})
+}
+
+func TestRegistryShares(t *testing.T) {
+	r := testRegistry(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var fi *FontInstance
+			var err error
+			if i%2 == 0 {
+				fi, err = r.At("cmr10", 12*Unity)
+			} else {
+				fi, err = r.Scaled("cmr10", 1200)
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			fi.SetParam(2, Scaled(i))
+			font, err := r.TFM("cmr10")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			font.SetParam(2, FixWord(i))
+		}(i)
+	}
+	wg.Wait()
+
+	orig, err := Load(bytes.NewReader(testTFM(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := RegistryStats{Hits: 19, Misses: 1, TFMHits: 39, Loads: 1}
+	if got := r.Stats(); got != want {
+		t.Errorf("got stats %+v, want %+v", got, want)
+	}
+	fi, err := r.At("cmr10", 12*Unity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fi.Space(), fi.Scale(orig.Space()); got != want {
+		t.Errorf("got instance space %v, want %v, unchanged by callers", got, want)
+	}
+	font, err := r.TFM("cmr10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := font.Space(), orig.Space(); got != want {
+		t.Errorf("got space %v, want %v, unchanged by callers", got, want)
+	}
+}
+
+func TestRegistryRetriesFailedLoads(t *testing.T) {
+	r := testRegistry(t)
+	for i := 0; i < 2; i++ {
+		if _, err := r.At("missing", 10*Unity); err == nil {
+			t.Fatal("loaded a missing font")
+		}
+	}
+	if got := r.Stats(); got.Loads != 2 || got.Misses != 0 {
+		t.Errorf("got stats %+v, want two loads and no instances", got)
+	}
+}
+
+func TestRegistryForgetsFailedInstances(t *testing.T) {
+	r := testRegistry(t)
+	for i := 0; i < 2; i++ {
+		if _, err := r.At("cmr10", 0); err == nil {
+			t.Fatal("made an instance at 0pt")
+		}
+	}
+	if got := r.Stats(); got.Misses != 2 || got.Hits != 0 {
+		t.Errorf("got stats %+v, want two misses and no hits", got)
+	}
+	if n := len(r.instances); n != 0 {
+		t.Errorf("got %v instances in the registry, want none", n)
+	}
+}
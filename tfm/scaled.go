@@ -0,0 +1,131 @@
+package tfm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SizeError is returned when a font is asked for at a size that TeX cannot
+// scale it to.
+type SizeError struct {
+	msg string
+}
+
+func (p SizeError) Error() string {
+	return p.msg
+}
+
+// FixWord is a TFM fix-word: a signed number with 20 bits after the binary
+// point. Except for the design size, fix-words in a TFM file are multiples of
+// the design size.
+type FixWord int32
+
+// FixWordUnity is the fix-word for 1.0.
+const FixWordUnity FixWord = 1 << 20
+
+// Float returns the fix-word as a floating-point number.
+func (fw FixWord) Float() float64 {
+	return FixWordScale * float64(fw)
+}
+
+// Scaled is a dimension in scaled points, TeX's unit of length: 65536sp make
+// one point.
+type Scaled int32
+
+// Unity is one point.
+const Unity Scaled = 1 << 16
+
+// MaxAtSize is the limit on the size a font can be loaded at; TeX's
+// arithmetic for scaling fix-words needs sizes to be below 2048pt.
+const MaxAtSize Scaled = 2048 * Unity
+
+// Points returns the dimension in points, as a floating-point number.
+func (s Scaled) Points() float64 {
+	return float64(s) / float64(Unity)
+}
+
+// String formats the dimension in points, as TeX's print_scaled does: with
+// the fewest decimal digits that read back as the same value.
+func (s Scaled) String() string {
+	var b strings.Builder
+	x := int64(s)
+	if x < 0 {
+		b.WriteByte('-')
+		x = -x
+	}
+	b.WriteString(strconv.FormatInt(x/int64(Unity), 10))
+	b.WriteByte('.')
+	x = 10*(x%int64(Unity)) + 5
+	delta := int64(10)
+	for {
+		if delta > int64(Unity) {
+			// Round the last digit.
+			x += 0x8000 - 50000
+		}
+		b.WriteByte(byte('0' + x/int64(Unity)))
+		x = 10 * (x % int64(Unity))
+		delta *= 10
+		if x <= delta {
+			break
+		}
+	}
+	b.WriteString("pt")
+	return b.String()
+}
+
+// Scaler converts fix-words to scaled points for a font used at a particular
+// size, with the exact arithmetic TeX uses when it loads a font, so that
+// dimensions agree with TeX's to the scaled point.
+type Scaler struct {
+	size  Scaled
+	z     int64
+	alpha int64
+	beta  int64
+}
+
+// NewScaler returns a Scaler for a font used at size, which must be positive
+// and less than MaxAtSize.
+func NewScaler(size Scaled) (Scaler, error) {
+	if size <= 0 || size >= MaxAtSize {
+		return Scaler{}, SizeError{msg: fmt.Sprintf("Improper at size %v: must be positive and less than 2048pt", size)}
+	}
+	// Scale z down until it fits in 23 bits, keeping track of the factor.
+	z := int64(size)
+	alpha := int64(16)
+	for z >= 0x800000 {
+		z /= 2
+		alpha += alpha
+	}
+	return Scaler{size: size, z: z, alpha: alpha * z, beta: 256 / alpha}, nil
+}
+
+// Size returns the size the Scaler scales to.
+func (s Scaler) Size() Scaled {
+	return s.size
+}
+
+// Scale returns fw times the size. Fix-words of magnitude 16 or more, which a
+// well-formed font never contains outside its header, are scaled with plain
+// truncating arithmetic.
+func (s Scaler) Scale(fw FixWord) Scaled {
+	u := uint32(fw)
+	a, b, c, d := int64(u>>24), int64(u>>16&0xff), int64(u>>8&0xff), int64(u&0xff)
+	sw := (((d*s.z)/256+c*s.z)/256 + b*s.z) / s.beta
+	switch a {
+	case 0:
+		return Scaled(sw)
+	case 255:
+		return Scaled(sw - s.alpha)
+	}
+	return Scaled(int64(fw) * int64(s.size) >> 20)
+}
+
+// ScaleFixWord returns fw times size, computed as by a Scaler.
+func ScaleFixWord(fw FixWord, size Scaled) (Scaled, error) {
+	s, err := NewScaler(size)
+	if err != nil {
+		return 0, err
+	}
+	return s.Scale(fw), nil
+}
@@ -0,0 +1,100 @@
+package tfm
+
+import (
+	"testing"
+)
+
+// The sizes the tests scale cmr10's fix-words to, which are written as
+// TFtoPL writes them.
+const (
+	tenPoint    Scaled = 10 * Unity
+	twelvePoint Scaled = 12 * Unity
+)
+
+func TestScale(t *testing.T) {
+	fix := func(s string) FixWord {
+		v, err := parseFix(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		name     string
+		fw       FixWord
+		size     Scaled
+		want     Scaled
+		wantText string
+	}{
+		// What TeX shows for cmr10: \wd, \ht and \dp of characters, and
+		// \fontdimen2 to 6.
+		{"A width", fix("0.750002"), tenPoint, 491521, "7.50002pt"},
+		{"A height", fix("0.683332"), tenPoint, 447828, "6.83331pt"},
+		{"g depth", fix("0.194445"), tenPoint, 127431, "1.94444pt"},
+		{"f italic correction", fix("0.077779"), tenPoint, 50973, "0.77779pt"},
+		{"space", fix("0.333334"), tenPoint, 218453, "3.33333pt"},
+		{"stretch", fix("0.166667"), tenPoint, 109226, "1.66666pt"},
+		{"shrink", fix("0.111112"), tenPoint, 72818, "1.11111pt"},
+		{"x-height", fix("0.430555"), tenPoint, 282168, "4.30554pt"},
+		{"quad", fix("1.000003"), tenPoint, 655361, "10.00002pt"},
+		// And for cmr10 at 12pt.
+		{"A width at 12pt", fix("0.750002"), twelvePoint, 589825, "9.00002pt"},
+		{"A height at 12pt", fix("0.683332"), twelvePoint, 537394, "8.19998pt"},
+		{"space at 12pt", fix("0.333334"), twelvePoint, 262144, "4.0pt"},
+		{"stretch at 12pt", fix("0.166667"), twelvePoint, 131072, "2.0pt"},
+		{"shrink at 12pt", fix("0.111112"), twelvePoint, 87381, "1.33333pt"},
+		{"quad at 12pt", fix("1.000003"), twelvePoint, 786434, "12.00003pt"},
+		// A size large enough that the scaling has to shift it down.
+		{"quad at 200pt", fix("1.000003"), 200 * Unity, 13107237, "200.00056pt"},
+		// Negative fix-words, such as cmr10's kerns, round down rather than
+		// towards zero.
+		{"kern", fix("-0.027779"), tenPoint, -18205, "-0.27779pt"},
+		{"kern rounded down", fix("-0.083334"), tenPoint, -54614, "-0.83334pt"},
+		{"kern at 12pt", fix("-0.083334"), twelvePoint, -65537, "-1.00002pt"},
+		{"smallest negative", -1, tenPoint, -1, "-0.00002pt"},
+		{"smallest positive", 1, tenPoint, 0, "0.0pt"},
+		// Fix-words near ±16, the limits of TeX's arithmetic.
+		{"just under 16", 16*FixWordUnity - 1, tenPoint, 10485759, "159.99998pt"},
+		{"just over -16", -16*FixWordUnity + 1, tenPoint, -10485760, "-160.0pt"},
+		{"-16", -16 * FixWordUnity, tenPoint, -10485760, "-160.0pt"},
+		{"-16 at 12pt", -16 * FixWordUnity, twelvePoint, -12582912, "-192.0pt"},
+		// Beyond them, which TeX rejects, the arithmetic is plain.
+		{"16", 16 * FixWordUnity, tenPoint, 10485760, "160.0pt"},
+		{"just under -16", -16*FixWordUnity - 1, tenPoint, -10485761, "-160.00002pt"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewScaler(test.size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.Scale(test.fw)
+			if got != test.want {
+				t.Errorf("got %vsp, want %vsp", int32(got), int32(test.want))
+			}
+			if got.String() != test.wantText {
+				t.Errorf("got %v, want %v", got, test.wantText)
+			}
+		})
+	}
+}
+
+func TestNewScalerSize(t *testing.T) {
+	tests := []struct {
+		size Scaled
+		ok   bool
+	}{
+		{1, true},
+		{tenPoint, true},
+		{MaxAtSize - 1, true},
+		{MaxAtSize, false},
+		{0, false},
+		{-tenPoint, false},
+	}
+	for _, test := range tests {
+		_, err := NewScaler(test.size)
+		if _, isSizeError := err.(SizeError); (err == nil) != test.ok || (err != nil && !isSizeError) {
+			t.Errorf("size %v: got %v", test.size, err)
+		}
+	}
+}
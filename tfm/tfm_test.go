@@ -0,0 +1,60 @@
+package tfm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testPL is a small font in property list form, as TFtoPL writes it.
+const testPL = `(FAMILY CMR)
+(FACE O 352)
+(CODINGSCHEME TeX text)
+(DESIGNSIZE R 10.0)
+(COMMENT DESIGNSIZE IS IN POINTS)
+(COMMENT OTHER SIZES ARE MULTIPLES OF DESIGNSIZE)
+(CHECKSUM O 2215053170)
+(SEVENBITSAFEFLAG TRUE)
+(FONTDIMEN
+   (SLANT R 0.0)
+   (SPACE R 0.333333)
+   (STRETCH R 0.166666)
+   (SHRINK R 0.111111)
+   (XHEIGHT R 0.429999)
+   (QUAD R 1.0)
+   (EXTRASPACE R 0.111111)
+   )
+(LIGTABLE
+   (LABEL C A)
+   (KRN C B R -0.025)
+   (LIG C C C B)
+   (STOP)
+   )
+(CHARACTER C A
+   (CHARWD R 0.5)
+   (CHARHT R 0.7)
+   (CHARDP R 0.099999)
+   (CHARIC R 0.049999)
+   )
+(CHARACTER C B
+   (CHARWD R 1.0)
+   )
+(CHARACTER C C
+   (CHARWD R 0.5)
+   (NEXTLARGER C A)
+   )
+`
+
+// testTFM returns testPL as a TFM file.
+func testTFM(t *testing.T) []byte {
+	t.Helper()
+	font, err := ParsePL(strings.NewReader(testPL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := font.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,314 @@
+package tfm
+
+import (
+	"fmt"
+)
+
+// Severity says how serious a problem found by Validate is.
+type Severity int
+
+const (
+	// Warning is for something unusual that TeX copes with.
+	Warning Severity = iota
+	// Error is for something TFtoPL would call a bad TFM file.
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Warning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Diagnostic is a problem found by Validate.
+type Diagnostic struct {
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%v: %v", d.Severity, d.Message)
+}
+
+// leftBoundary stands for the left word boundary in the states of the
+// ligature loop search, in place of a character.
+const leftBoundary = 256
+
+type validator struct {
+	tfm         *TFM
+	diagnostics []Diagnostic
+}
+
+func (v *validator) report(severity Severity, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the font for the problems that TFtoPL checks for, and
+// returns what it finds; the font is fine if there is nothing. Loading a
+// font checks only what is needed to read it, so a font that loads can still
+// be inconsistent, for example by referring to characters it does not have.
+func (tfm *TFM) Validate() []Diagnostic {
+	v := &validator{tfm: tfm}
+	v.checkCharRange()
+	v.checkDimensionTables()
+	v.checkCharInfos()
+	v.checkParams()
+	v.checkLigKerns()
+	v.checkLigatureLoops()
+	return v.diagnostics
+}
+
+func (v *validator) checkCharRange() {
+	bc, ec := v.tfm.smallestCharCode, v.tfm.largestCharCode
+	if ec > 255 {
+		v.report(Error, "Largest character code %v is more than 255", ec)
+	}
+	if bc > ec+1 {
+		v.report(Error, "Smallest character code %v is more than one past the largest, %v", bc, ec)
+	}
+}
+
+// checkFixWord reports a fix-word of magnitude 16 or more, which TeX cannot
+// scale.
+func (v *validator) checkFixWord(fw FixWord, format string, args ...interface{}) {
+	if fw >= 16*FixWordUnity || fw < -16*FixWordUnity {
+		v.report(Error, "%v is %v, not less than 16 in magnitude", fmt.Sprintf(format, args...), fw.Float())
+	}
+}
+
+func (v *validator) checkDimensionTables() {
+	tables := []struct {
+		table Table
+		vs    []FixWord
+	}{
+		{Width, v.tfm.widths},
+		{Height, v.tfm.heights},
+		{Depth, v.tfm.depths},
+		{ItalicCorrection, v.tfm.italics},
+		{Kern, v.tfm.kerns},
+	}
+	for _, t := range tables {
+		if t.table != Kern {
+			if len(t.vs) == 0 {
+				v.report(Error, "%v table is empty", t.table)
+			} else if t.vs[0] != 0 {
+				v.report(Error, "%v[0] is %v, not zero", t.table, t.vs[0].Float())
+			}
+		}
+		for i, fw := range t.vs {
+			v.checkFixWord(fw, "%v[%v]", t.table, i)
+		}
+	}
+}
+
+// exists returns whether a character code is in the font.
+func (v *validator) exists(code byte) bool {
+	return v.tfm.HasChar(code)
+}
+
+func (v *validator) checkCharInfos() {
+	tfm := v.tfm
+	for i, ci := range tfm.charInfos {
+		code := int(tfm.smallestCharCode) + i
+		if ci.widthIndex == 0 {
+			continue
+		}
+		if int(ci.widthIndex) >= len(tfm.widths) {
+			v.report(Error, "Character %#o has width index %v, past the end of the width table", code, ci.widthIndex)
+		}
+		if int(ci.heightIndex) >= len(tfm.heights) {
+			v.report(Error, "Character %#o has height index %v, past the end of the height table", code, ci.heightIndex)
+		}
+		if int(ci.depthIndex) >= len(tfm.depths) {
+			v.report(Error, "Character %#o has depth index %v, past the end of the depth table", code, ci.depthIndex)
+		}
+		if int(ci.italicIndex) >= len(tfm.italics) {
+			v.report(Error, "Character %#o has italic correction index %v, past the end of the italic correction table", code, ci.italicIndex)
+		}
+		switch ci.tag {
+		case LigTag:
+			if int(ci.remainder) >= len(tfm.ligKerns) {
+				v.report(Error, "Character %#o has lig/kern program at %v, past the end of the lig/kern table", code, ci.remainder)
+			}
+		case ListTag:
+			if !v.exists(ci.remainder) {
+				v.report(Error, "Character %#o has nonexistent next larger character %#o", code, ci.remainder)
+			} else if _, err := tfm.CharList(byte(code)); err != nil {
+				v.report(Error, "%v", err)
+			}
+		case ExtTag:
+			if int(ci.remainder) >= len(tfm.extensibles) {
+				v.report(Error, "Character %#o has extensible recipe %v, past the end of the extensible character table", code, ci.remainder)
+				continue
+			}
+			er := tfm.extensibles[ci.remainder]
+			pieces := []struct {
+				name string
+				c    byte
+			}{{"top", er.top}, {"middle", er.mid}, {"bottom", er.bot}}
+			for _, p := range pieces {
+				if p.c != 0 && !v.exists(p.c) {
+					v.report(Error, "Character %#o has nonexistent %v piece %#o", code, p.name, p.c)
+				}
+			}
+			if !v.exists(er.rep) {
+				v.report(Error, "Character %#o has nonexistent repeated piece %#o", code, er.rep)
+			}
+		}
+	}
+}
+
+func (v *validator) checkParams() {
+	// The slant is a pure number, so may be of any size.
+	for i := 1; i < len(v.tfm.params); i++ {
+		v.checkFixWord(v.tfm.params[i], "Parameter %v", i+1)
+	}
+}
+
+// checkLigKerns checks the instructions of every lig/kern program, each
+// instruction once.
+func (v *validator) checkLigKerns() {
+	tfm := v.tfm
+	checked := make([]bool, len(tfm.ligKerns))
+	check := func(label int, owner string) {
+		for k := tfm.programStart(label); ; {
+			if k >= len(tfm.ligKerns) {
+				v.report(Error, "Lig/kern program for %v runs past the end of the lig/kern table", owner)
+				return
+			}
+			if checked[k] {
+				return
+			}
+			checked[k] = true
+			lk := tfm.ligKerns[k]
+			if lk.skipByte <= stopFlag {
+				v.checkLigKernInstruction(k, lk)
+			}
+			if lk.skipByte >= stopFlag {
+				return
+			}
+			k += int(lk.skipByte) + 1
+		}
+	}
+	for i, ci := range tfm.charInfos {
+		if ci.widthIndex != 0 && ci.tag == LigTag && int(ci.remainder) < len(tfm.ligKerns) {
+			check(int(ci.remainder), fmt.Sprintf("character %#o", int(tfm.smallestCharCode)+i))
+		}
+	}
+	if tfm.boundaryCharLabel >= 0 {
+		if tfm.boundaryCharLabel >= len(tfm.ligKerns) {
+			v.report(Error, "Left boundary lig/kern program starts at %v, past the end of the lig/kern table", tfm.boundaryCharLabel)
+		} else {
+			check(tfm.boundaryCharLabel, "the left boundary")
+		}
+	}
+}
+
+func (v *validator) checkLigKernInstruction(k int, lk ligKernInstruction) {
+	tfm := v.tfm
+	if !v.exists(lk.nextChar) && !(tfm.hasBoundaryChar && lk.nextChar == tfm.boundaryChar) {
+		v.report(Warning, "Lig/kern instruction %v is for nonexistent character %#o", k, lk.nextChar)
+	}
+	if lk.opByte >= kernFlag {
+		if i := 256*int(lk.opByte-kernFlag) + int(lk.remainder); i >= len(tfm.kerns) {
+			v.report(Error, "Lig/kern instruction %v refers to kern %v, past the end of the kern table", k, i)
+		}
+		return
+	}
+	if !LigOp(lk.opByte).Valid() {
+		v.report(Error, "Lig/kern instruction %v has invalid ligature operation %v", k, lk.opByte)
+	}
+	if !v.exists(lk.remainder) {
+		v.report(Error, "Lig/kern instruction %v makes nonexistent ligature character %#o", k, lk.remainder)
+	}
+}
+
+// ligStep returns the pair of characters that TeX looks at next after
+// applying the ligature, if any, between left and right, where left may be
+// leftBoundary. ok is false if there is no ligature, or if TeX would next
+// look at a character from further on in the input, which ends any loop.
+func (v *validator) ligStep(left int, right byte) (nextLeft int, nextRight byte, ok bool) {
+	var res LigKernResult
+	if left == leftBoundary {
+		res, ok = v.tfm.LeftBoundaryLigKern(right)
+	} else {
+		res, ok = v.tfm.LookupLigKern(byte(left), right)
+	}
+	if !ok || !res.IsLigature {
+		return 0, 0, false
+	}
+	// The characters after the ligature, of which TeX moves past Skip.
+	seq := []int{int(res.Char)}
+	if res.Op.KeepLeft() {
+		seq = append([]int{left}, seq...)
+	}
+	if res.Op.KeepRight() {
+		seq = append(seq, int(right))
+	}
+	i := res.Op.Skip()
+	if i+1 >= len(seq) {
+		return 0, 0, false
+	}
+	return seq[i], byte(seq[i+1]), true
+}
+
+// checkLigatureLoops looks for pairs of characters whose ligatures lead back
+// to themselves without TeX taking in any more input, which would make TeX
+// loop forever, as TFtoPL does.
+func (v *validator) checkLigatureLoops() {
+	var lefts []int
+	var rights []byte
+	for c := 0; c < 256; c++ {
+		if v.exists(byte(c)) {
+			lefts = append(lefts, c)
+			rights = append(rights, byte(c))
+		}
+	}
+	if v.tfm.boundaryCharLabel >= 0 {
+		lefts = append(lefts, leftBoundary)
+	}
+	if bchar, ok := v.tfm.BoundaryChar(); ok && !v.exists(bchar) {
+		rights = append(rights, bchar)
+	}
+
+	// Each pair leads to at most one other, so a depth-first walk along the
+	// chain from each pair finds every cycle.
+	const (
+		unvisited = iota
+		onChain
+		done
+	)
+	state := make(map[[2]int]int)
+	for _, left := range lefts {
+		for _, right := range rights {
+			var chain [][2]int
+			l, r := left, right
+			for {
+				pair := [2]int{l, int(r)}
+				if s := state[pair]; s == onChain {
+					v.report(Error, "Infinite ligature loop starting with %v and %#o", formatLoopChar(l), r)
+					break
+				} else if s == done {
+					break
+				}
+				state[pair] = onChain
+				chain = append(chain, pair)
+				var ok bool
+				if l, r, ok = v.ligStep(l, r); !ok {
+					break
+				}
+			}
+			for _, pair := range chain {
+				state[pair] = done
+			}
+		}
+	}
+}
+
+func formatLoopChar(c int) string {
+	if c == leftBoundary {
+		return "the left boundary"
+	}
+	return fmt.Sprintf("%#o", c)
+}
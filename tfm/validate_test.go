@@ -0,0 +1,91 @@
+package tfm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// tfmLayout gives the offsets in bytes of the tables of a TFM file.
+type tfmLayout struct {
+	charInfo, widths, ligKern int
+}
+
+func layout(bs []byte) tfmLayout {
+	word := func(i int) int { return int(binary.BigEndian.Uint16(bs[2*i:])) }
+	lh, bc, ec, nw, nh, nd, ni := word(1), word(2), word(3), word(4), word(5), word(6), word(7)
+	var l tfmLayout
+	l.charInfo = 4 * (6 + lh)
+	l.widths = l.charInfo + 4*(ec-bc+1)
+	l.ligKern = l.widths + 4*(nw+nh+nd+ni)
+	return l
+}
+
+// char returns the offset of the char_info word of a character of
+// testPL, whose smallest character is A.
+func (l tfmLayout) char(c byte) int {
+	return l.charInfo + 4*int(c-'A')
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    func(bs []byte, l tfmLayout)
+		severity Severity
+		message  string
+	}{
+		{"width[0]", func(bs []byte, l tfmLayout) {
+			bs[l.widths+3] = 5
+		}, Error, "Width[0] is 4.76837158203125e-06, not zero"},
+		{"width index", func(bs []byte, l tfmLayout) {
+			bs[l.char('A')] = 0xff
+		}, Error, "Character 0101 has width index 255, past the end of the width table"},
+		{"next larger", func(bs []byte, l tfmLayout) {
+			bs[l.char('C')+3] = 'Z'
+		}, Error, "Character 0103 has nonexistent next larger character 0132"},
+		{"next larger loop", func(bs []byte, l tfmLayout) {
+			bs[l.char('C')+3] = 'C'
+		}, Error, "Charlist starting at 0103 cycles back to 0103"},
+		{"lig/kern character", func(bs []byte, l tfmLayout) {
+			bs[l.ligKern+1] = 'Z'
+		}, Warning, "Lig/kern instruction 0 is for nonexistent character 0132"},
+		{"ligature operation", func(bs []byte, l tfmLayout) {
+			bs[l.ligKern+4+2] = 4
+		}, Error, "Lig/kern instruction 1 has invalid ligature operation 4"},
+		{"ligature character", func(bs []byte, l tfmLayout) {
+			bs[l.ligKern+4+3] = 'Z'
+		}, Error, "Lig/kern instruction 1 makes nonexistent ligature character 0132"},
+		{"ligature loop", func(bs []byte, l tfmLayout) {
+			// A C |=: C leaves A C to be looked at again.
+			bs[l.ligKern+4+2] = 2
+			bs[l.ligKern+4+3] = 'C'
+		}, Error, "Infinite ligature loop starting with 0101 and 0103"},
+	}
+
+	font, err := Load(bytes.NewReader(testTFM(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds := font.Validate(); len(ds) != 0 {
+		t.Errorf("unmodified font: got %v, want nothing", ds)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bs := testTFM(t)
+			test.patch(bs, layout(bs))
+			font, err := Load(bytes.NewReader(bs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ds := font.Validate()
+			for _, d := range ds {
+				if d.Severity == test.severity && strings.Contains(d.Message, test.message) {
+					return
+				}
+			}
+			t.Errorf("got %v, want %v containing %q", ds, test.severity, test.message)
+		})
+	}
+}
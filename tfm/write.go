@@ -0,0 +1,147 @@
+package tfm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+func write1bui(w io.Writer, v uint8) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func write2bui(w io.Writer, v uint16) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func write4bsi(w io.Writer, v int32) error {
+	return binary.Write(w, binary.BigEndian, v)
+}
+
+func writeFixWord(w io.Writer, v FixWord) error {
+	return write4bsi(w, int32(v))
+}
+
+// putBCPL stores s as a BCPL string in a header field. The field is left
+// alone if it already holds s, so that any padding after the string is kept.
+func putBCPL(field []byte, s string) {
+	if len(field) > 0 && int(field[0]) < len(field) && string(field[1:1+field[0]]) == s {
+		return
+	}
+	for i := range field {
+		field[i] = 0
+	}
+	field[0] = byte(len(s))
+	copy(field[1:], s)
+}
+
+// encodeHeader returns the header table, with the fields that the TFM
+// struct interprets written over the raw header that was read.
+func (tfm *TFM) encodeHeader() []byte {
+	lh := int(tfm.headerDataLengthWords)
+	if lh < HeaderDataLengthWordsMin {
+		lh = HeaderDataLengthWordsMin
+	}
+	if tfm.characterCodingScheme != "" && lh < characterCodingSchemeHeaderLength {
+		lh = characterCodingSchemeHeaderLength
+	}
+	if tfm.family != "" && lh < familyHeaderLength {
+		lh = familyHeaderLength
+	}
+	header := make([]byte, 4*lh)
+	copy(header, tfm.header)
+
+	binary.BigEndian.PutUint32(header[0:], tfm.checksum)
+	binary.BigEndian.PutUint32(header[4:], uint32(tfm.designFontSize))
+	position := 8
+	if lh >= characterCodingSchemeHeaderLength {
+		putBCPL(header[position:position+CharacterCodingSchemeLength], tfm.characterCodingScheme)
+	}
+	position += CharacterCodingSchemeLength
+	if lh >= familyHeaderLength {
+		putBCPL(header[position:position+FamilyLength], tfm.family)
+	}
+	position += FamilyLength
+	if lh >= faceHeaderLength {
+		header[position] &^= 128
+		if tfm.sevenBitSafe {
+			header[position] |= 128
+		}
+		header[position+3] = byte(tfm.face)
+	}
+	return header
+}
+
+// WriteTo writes the font in TFM format. Table lengths and the file length
+// are recomputed from the tables, so a font that has been read and not
+// modified is written back byte for byte.
+func (tfm *TFM) WriteTo(w io.Writer) (n int64, err error) {
+	header := tfm.encodeHeader()
+	nrChars := len(tfm.charInfos)
+	if nrChars != int(tfm.largestCharCode)+1-int(tfm.smallestCharCode) {
+		return 0, TableLengthError{msg: fmt.Sprintf("Have %v character info words for character codes %v to %v", nrChars, tfm.smallestCharCode, tfm.largestCharCode)}
+	}
+
+	tableLengthsWords := []int{
+		Header:              len(header) / 4,
+		CharacterInfo:       nrChars,
+		Width:               len(tfm.widths),
+		Height:              len(tfm.heights),
+		Depth:               len(tfm.depths),
+		ItalicCorrection:    len(tfm.italics),
+		LigKern:             len(tfm.ligKerns),
+		Kern:                len(tfm.kerns),
+		ExtensibleCharacter: len(tfm.extensibles),
+		FontParameter:       len(tfm.params),
+	}
+	// The reverse of inferring table pointers from table lengths: the file
+	// length counts the lengths themselves, then every table.
+	fileLengthWords := HeaderPointer / 4
+	for table, length := range tableLengthsWords {
+		if length > math.MaxUint16 {
+			return 0, TableLengthError{msg: fmt.Sprintf("Table %v has %v entries, too many to encode", Table(table), length)}
+		}
+		fileLengthWords += length
+	}
+	if fileLengthWords > math.MaxUint16 {
+		return 0, TableLengthError{msg: fmt.Sprintf("File would be %v words long, too long to encode", fileLengthWords)}
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(4 * fileLengthWords)
+	write2bui(&buf, uint16(fileLengthWords))
+	write2bui(&buf, uint16(tableLengthsWords[Header]))
+	write2bui(&buf, tfm.smallestCharCode)
+	write2bui(&buf, tfm.largestCharCode)
+	for table := Width; table < NrTables; table++ {
+		write2bui(&buf, uint16(tableLengthsWords[table]))
+	}
+
+	buf.Write(header)
+	for _, ci := range tfm.charInfos {
+		write1bui(&buf, ci.widthIndex)
+		write1bui(&buf, ci.heightIndex<<4|ci.depthIndex&0xf)
+		write1bui(&buf, ci.italicIndex<<2|uint8(ci.tag)&0x3)
+		write1bui(&buf, ci.remainder)
+	}
+	for _, table := range [][]FixWord{tfm.widths, tfm.heights, tfm.depths, tfm.italics} {
+		for _, v := range table {
+			writeFixWord(&buf, v)
+		}
+	}
+	for _, lk := range tfm.ligKerns {
+		buf.Write([]byte{lk.skipByte, lk.nextChar, lk.opByte, lk.remainder})
+	}
+	for _, v := range tfm.kerns {
+		writeFixWord(&buf, v)
+	}
+	for _, er := range tfm.extensibles {
+		buf.Write([]byte{er.top, er.mid, er.bot, er.rep})
+	}
+	for _, v := range tfm.params {
+		writeFixWord(&buf, v)
+	}
+	return buf.WriteTo(w)
+}
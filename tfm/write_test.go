@@ -0,0 +1,67 @@
+package tfm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The fonts in testdata are small fonts made for the tests: test.tfm has
+// kerns, a ligature and a charlist, and math.tfm a boundary character, an
+// extensible character, a skip in its lig/kern program and extra parameters.
+var testFonts = []string{"test.tfm", "math.tfm"}
+
+func readTestFont(t *testing.T, name string) []byte {
+	t.Helper()
+	bs, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	for _, name := range testFonts {
+		bs := readTestFont(t, name)
+		font, err := Load(bytes.NewReader(bs))
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		var buf bytes.Buffer
+		n, err := font.WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if n != int64(buf.Len()) {
+			t.Errorf("%v: WriteTo returned %v, wrote %v bytes", name, n, buf.Len())
+		}
+		if !bytes.Equal(buf.Bytes(), bs) {
+			t.Errorf("%v: writing the loaded font changed its bytes", name)
+		}
+	}
+}
+
+func TestWriteSetParam(t *testing.T) {
+	font, err := Load(bytes.NewReader(readTestFont(t, "test.tfm")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := font.SetParam(9, FixWordUnity/4); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := font.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := loaded.Param(9); !ok || got != FixWordUnity/4 {
+		t.Errorf("got parameter 9 %v, %v, want %v", got, ok, FixWordUnity/4)
+	}
+	if got, want := loaded.NrParams(), 9; got != want {
+		t.Errorf("got %v parameters, want %v", got, want)
+	}
+}
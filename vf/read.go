@@ -0,0 +1,55 @@
+package vf
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/eddiejessup/gnex/tfm"
+)
+
+func read1bui(r io.Reader) (v uint8, err error) {
+	err = binary.Read(r, binary.BigEndian, &v)
+	return
+}
+
+func read4bui(r io.Reader) (v uint32, err error) {
+	err = binary.Read(r, binary.BigEndian, &v)
+	return
+}
+
+// readNbui reads an n-byte unsigned integer, for n from 1 to 4.
+func readNbui(r io.Reader, n int) (v uint32, err error) {
+	for i := 0; i < n; i++ {
+		var b uint8
+		if b, err = read1bui(r); err != nil {
+			return
+		}
+		v = v<<8 | uint32(b)
+	}
+	return
+}
+
+// readNbsi reads an n-byte signed integer, for n from 1 to 4.
+func readNbsi(r io.Reader, n int) (v int32, err error) {
+	u, err := readNbui(r, n)
+	if err != nil {
+		return
+	}
+	// Sign-extend from the top bit of the n bytes.
+	shift := uint(32 - 8*n)
+	v = int32(u<<shift) >> shift
+	return
+}
+
+func readFixWord(r io.Reader) (v tfm.FixWord, err error) {
+	x, err := readNbsi(r, 4)
+	v = tfm.FixWord(x)
+	return
+}
+
+func readString(r io.Reader, length int) (s string, err error) {
+	sb := make([]byte, length, length)
+	_, err = io.ReadFull(r, sb)
+	s = string(sb)
+	return
+}
@@ -0,0 +1,520 @@
+package vf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/eddiejessup/gnex/tfm"
+	"github.com/eddiejessup/gnex/vfs"
+)
+
+// FormatError is returned when a VF file or one of its character packets is
+// malformed.
+type FormatError struct {
+	msg string
+}
+
+func (p FormatError) Error() string {
+	return p.msg
+}
+
+// FontDefOrderError is returned when a font definition follows a character
+// packet, as all of a VF file's font definitions must come first.
+type FontDefOrderError struct {
+	msg string
+}
+
+func (p FontDefOrderError) Error() string {
+	return p.msg
+}
+
+// DuplicatePacketError is returned when a VF file has two packets for the
+// same character.
+type DuplicatePacketError struct {
+	msg string
+}
+
+func (p DuplicatePacketError) Error() string {
+	return p.msg
+}
+
+// Opcodes of the VF file format, and of the DVI commands in packets.
+const (
+	setChar0   = 0
+	set1       = 128
+	setRule    = 132
+	put1       = 133
+	putRule    = 137
+	nop        = 138
+	bop        = 139
+	eop        = 140
+	push       = 141
+	pop        = 142
+	right1     = 143
+	w0         = 147
+	w1         = 148
+	x0         = 152
+	x1         = 153
+	down1      = 157
+	y0         = 161
+	y1         = 162
+	z0         = 166
+	z1         = 167
+	fntNum0    = 171
+	fnt1       = 235
+	xxx1       = 239
+	longChar   = 242
+	fntDef1    = 243
+	pre        = 247
+	post       = 248
+	identifier = 202
+)
+
+// FontDef is a font that a virtual font's packets refer to.
+type FontDef struct {
+	Number   uint32
+	Checksum uint32
+	// Scale is the size at which the font is used, and DesignSize its design
+	// size, both as multiples of the virtual font's design size.
+	Scale      tfm.FixWord
+	DesignSize tfm.FixWord
+	Area       string
+	Name       string
+	// TFM holds the font's metrics, once LinkFonts has loaded them.
+	TFM *tfm.TFM
+}
+
+// Packet is the sequence of DVI commands that typesets one character of a
+// virtual font.
+type Packet struct {
+	// Width is the character's width, as a multiple of the design size.
+	Width tfm.FixWord
+	DVI   []byte
+}
+
+type VirtualFont struct {
+	Comment  string
+	Checksum uint32
+	// DesignSize is the design size in points.
+	DesignSize tfm.FixWord
+	// Fonts are the fonts defined in the file, in order of definition; the
+	// first is the one packets start out typesetting in.
+	Fonts       []*FontDef
+	fontNumbers map[uint32]*FontDef
+	Packets     map[uint32]*Packet
+	// TFM holds the metrics of the virtual font itself.
+	TFM *tfm.TFM
+}
+
+// LoadFile reads a VF file from the file system. t is the TFM file that
+// accompanies it, and may be nil.
+func LoadFile(path string, t *tfm.TFM) (*VirtualFont, error) {
+	return LoadFS(vfs.OS, path, t)
+}
+
+// LoadFS reads the VF file at path in fsys.
+func LoadFS(fsys fs.FS, path string, t *tfm.TFM) (*VirtualFont, error) {
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Load(file, t)
+}
+
+// readError converts running off the end of the file into a FormatError.
+func readError(err error, what string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return FormatError{msg: fmt.Sprintf("File ended while reading %v", what)}
+	}
+	return err
+}
+
+// Load reads a VF file from r. t is the TFM file that accompanies it, and
+// may be nil.
+func Load(r io.Reader, t *tfm.TFM) (*VirtualFont, error) {
+	vf := &VirtualFont{
+		fontNumbers: make(map[uint32]*FontDef),
+		Packets:     make(map[uint32]*Packet),
+		TFM:         t,
+	}
+	if err := vf.readPreamble(r); err != nil {
+		return nil, err
+	}
+	for {
+		op, err := read1bui(r)
+		if err != nil {
+			return nil, readError(err, "postamble")
+		}
+		switch {
+		case op < longChar:
+			err = vf.readShortPacket(r, int(op))
+		case op == longChar:
+			err = vf.readLongPacket(r)
+		case op >= fntDef1 && op < fntDef1+4:
+			if len(vf.Packets) > 0 {
+				return nil, FontDefOrderError{msg: "Font definition after a character packet"}
+			}
+			err = vf.readFontDef(r, int(op-fntDef1)+1)
+		case op == post:
+			return vf, nil
+		default:
+			err = FormatError{msg: fmt.Sprintf("Unexpected opcode %v between packets", op)}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (vf *VirtualFont) readPreamble(r io.Reader) (err error) {
+	op, err := read1bui(r)
+	if err != nil {
+		return readError(err, "preamble")
+	}
+	id, err := read1bui(r)
+	if err != nil {
+		return readError(err, "preamble")
+	}
+	if op != pre || id != identifier {
+		return FormatError{msg: fmt.Sprintf("Bad preamble: opcode %v, identifier %v", op, id)}
+	}
+	k, err := read1bui(r)
+	if err != nil {
+		return readError(err, "preamble")
+	}
+	if vf.Comment, err = readString(r, int(k)); err != nil {
+		return readError(err, "comment")
+	}
+	if vf.Checksum, err = read4bui(r); err != nil {
+		return readError(err, "checksum")
+	}
+	if vf.DesignSize, err = readFixWord(r); err != nil {
+		return readError(err, "design size")
+	}
+	return nil
+}
+
+func (vf *VirtualFont) readFontDef(r io.Reader, n int) (err error) {
+	def := &FontDef{}
+	if def.Number, err = readNbui(r, n); err != nil {
+		return readError(err, "font definition")
+	}
+	if def.Checksum, err = read4bui(r); err != nil {
+		return readError(err, "font definition")
+	}
+	if def.Scale, err = readFixWord(r); err != nil {
+		return readError(err, "font definition")
+	}
+	if def.DesignSize, err = readFixWord(r); err != nil {
+		return readError(err, "font definition")
+	}
+	a, err := read1bui(r)
+	if err != nil {
+		return readError(err, "font definition")
+	}
+	l, err := read1bui(r)
+	if err != nil {
+		return readError(err, "font definition")
+	}
+	if def.Area, err = readString(r, int(a)); err != nil {
+		return readError(err, "font area")
+	}
+	if def.Name, err = readString(r, int(l)); err != nil {
+		return readError(err, "font name")
+	}
+	if _, ok := vf.fontNumbers[def.Number]; ok {
+		return FormatError{msg: fmt.Sprintf("Font %v is defined twice", def.Number)}
+	}
+	vf.Fonts = append(vf.Fonts, def)
+	vf.fontNumbers[def.Number] = def
+	return nil
+}
+
+func (vf *VirtualFont) readShortPacket(r io.Reader, length int) (err error) {
+	code, err := read1bui(r)
+	if err != nil {
+		return readError(err, "character packet")
+	}
+	// The width is unsigned in a short packet, which is only used for
+	// widths of less than 16 design units.
+	width, err := readNbui(r, 3)
+	if err != nil {
+		return readError(err, "character packet")
+	}
+	return vf.readPacketDVI(r, uint32(code), tfm.FixWord(width), length)
+}
+
+func (vf *VirtualFont) readLongPacket(r io.Reader) (err error) {
+	length, err := read4bui(r)
+	if err != nil {
+		return readError(err, "character packet")
+	}
+	code, err := read4bui(r)
+	if err != nil {
+		return readError(err, "character packet")
+	}
+	width, err := readFixWord(r)
+	if err != nil {
+		return readError(err, "character packet")
+	}
+	return vf.readPacketDVI(r, code, width, int(length))
+}
+
+func (vf *VirtualFont) readPacketDVI(r io.Reader, code uint32, width tfm.FixWord, length int) (err error) {
+	if length < 0 {
+		return FormatError{msg: fmt.Sprintf("Packet for character %v has negative length", code)}
+	}
+	if _, ok := vf.Packets[code]; ok {
+		return DuplicatePacketError{msg: fmt.Sprintf("Character %v has more than one packet", code)}
+	}
+	dvi := make([]byte, length)
+	if _, err = io.ReadFull(r, dvi); err != nil {
+		return readError(err, fmt.Sprintf("packet for character %v", code))
+	}
+	vf.Packets[code] = &Packet{Width: width, DVI: dvi}
+	return nil
+}
+
+// LinkFonts loads the metrics of every font the virtual font refers to,
+// using load to find a TFM file by font name. A font whose checksum does not
+// match is still linked; callers that want to warn, as DVItype does, can check
+// ChecksumMatches.
+func (vf *VirtualFont) LinkFonts(load func(name string) (*tfm.TFM, error)) error {
+	for _, def := range vf.Fonts {
+		t, err := load(def.Name)
+		if err != nil {
+			return err
+		}
+		def.TFM = t
+	}
+	return nil
+}
+
+// ChecksumMatches returns whether the checksum recorded for the font agrees
+// with that of its TFM file, as tfm.ChecksumsMatch decides. It is true if the
+// font's metrics have not been loaded.
+func (def *FontDef) ChecksumMatches() bool {
+	return def.TFM == nil || def.TFM.ChecksumMatches(def.Checksum)
+}
+
+// ChecksumMatches returns whether the virtual font's checksum agrees with
+// that of its own TFM file, which is true if it has none.
+func (vf *VirtualFont) ChecksumMatches() bool {
+	return vf.TFM == nil || vf.TFM.ChecksumMatches(vf.Checksum)
+}
+
+// Font returns the font with the given number.
+func (vf *VirtualFont) Font(number uint32) (def *FontDef, ok bool) {
+	def, ok = vf.fontNumbers[number]
+	return
+}
+
+type ItemKind int
+
+const (
+	// A character from one of the fonts the virtual font refers to.
+	CharItem ItemKind = iota
+	// A rule.
+	RuleItem
+	// A \special.
+	SpecialItem
+)
+
+// Item is one thing that a character of a virtual font expands into. All
+// dimensions are multiples of the virtual font's design size, and positions
+// are relative to the reference point of the virtual character, with V
+// increasing downwards as in DVI.
+type Item struct {
+	Kind ItemKind
+	H    tfm.FixWord
+	V    tfm.FixWord
+	// Font and Char are set for characters.
+	Font *FontDef
+	Char uint32
+	// Width and Height are set for rules.
+	Width  tfm.FixWord
+	Height tfm.FixWord
+	// Special is set for specials.
+	Special []byte
+}
+
+type dviRegisters struct {
+	h, v, w, x, y, z tfm.FixWord
+}
+
+// Expand interprets the packet for a character, returning the characters,
+// rules and specials it places. Characters set with set commands advance the
+// position by their width, which needs the font's metrics to have been
+// linked.
+func (vf *VirtualFont) Expand(code uint32) (items []Item, err error) {
+	packet, ok := vf.Packets[code]
+	if !ok {
+		return nil, FormatError{msg: fmt.Sprintf("No packet for character %v", code)}
+	}
+	if len(vf.Fonts) == 0 && len(packet.DVI) > 0 {
+		return nil, FormatError{msg: "Virtual font defines no fonts"}
+	}
+	errorf := func(format string, args ...interface{}) error {
+		return FormatError{msg: fmt.Sprintf("Packet for character %v: ", code) + fmt.Sprintf(format, args...)}
+	}
+
+	r := bytes.NewReader(packet.DVI)
+	var regs dviRegisters
+	var stack []dviRegisters
+	var font *FontDef
+	if len(vf.Fonts) > 0 {
+		font = vf.Fonts[0]
+	}
+	dimen := func(n int) (tfm.FixWord, error) {
+		x, err := readNbsi(r, n)
+		return tfm.FixWord(x), err
+	}
+	typeset := func(c uint32, move bool) error {
+		items = append(items, Item{Kind: CharItem, H: regs.h, V: regs.v, Font: font, Char: c})
+		if !move {
+			return nil
+		}
+		if font.TFM == nil {
+			return errorf("Font %v has not been linked", font.Name)
+		}
+		if c > 255 {
+			return errorf("Character %v is not in font %v", c, font.Name)
+		}
+		width, _, _, _, ok := font.TFM.CharDimensions(byte(c))
+		if !ok {
+			return errorf("Character %v is not in font %v", c, font.Name)
+		}
+		// TeX's scaling arithmetic works in any units, so the scale, a
+		// fix-word, can stand in for a size in scaled points.
+		scaler, err := tfm.NewScaler(tfm.Scaled(font.Scale))
+		if err != nil {
+			return errorf("Font %v: %v", font.Name, err)
+		}
+		regs.h += tfm.FixWord(scaler.Scale(width))
+		return nil
+	}
+	selectFont := func(number uint32) error {
+		def, ok := vf.fontNumbers[number]
+		if !ok {
+			return errorf("Font %v is not defined", number)
+		}
+		font = def
+		return nil
+	}
+	rule := func(move bool) error {
+		height, err := dimen(4)
+		if err != nil {
+			return err
+		}
+		width, err := dimen(4)
+		if err != nil {
+			return err
+		}
+		if height > 0 && width > 0 {
+			items = append(items, Item{Kind: RuleItem, H: regs.h, V: regs.v, Width: width, Height: height})
+		}
+		if move {
+			regs.h += width
+		}
+		return nil
+	}
+
+	for {
+		op, err := read1bui(r)
+		if err == io.EOF {
+			break
+		}
+		switch {
+		case op < set1:
+			err = typeset(uint32(op-setChar0), true)
+		case op < setRule:
+			var c uint32
+			if c, err = readNbui(r, int(op-set1)+1); err == nil {
+				err = typeset(c, true)
+			}
+		case op == setRule:
+			err = rule(true)
+		case op < putRule:
+			var c uint32
+			if c, err = readNbui(r, int(op-put1)+1); err == nil {
+				err = typeset(c, false)
+			}
+		case op == putRule:
+			err = rule(false)
+		case op == nop:
+		case op == push:
+			stack = append(stack, regs)
+		case op == pop:
+			if len(stack) == 0 {
+				return nil, errorf("Pop with an empty stack")
+			}
+			regs = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		case op == bop || op == eop:
+			return nil, errorf("Opcode %v is not allowed in a packet", op)
+		case right1 <= op && op < w0:
+			var d tfm.FixWord
+			if d, err = dimen(int(op-right1) + 1); err == nil {
+				regs.h += d
+			}
+		case op == w0:
+			regs.h += regs.w
+		case op < x0:
+			if regs.w, err = dimen(int(op-w1) + 1); err == nil {
+				regs.h += regs.w
+			}
+		case op == x0:
+			regs.h += regs.x
+		case op < down1:
+			if regs.x, err = dimen(int(op-x1) + 1); err == nil {
+				regs.h += regs.x
+			}
+		case op < y0:
+			var d tfm.FixWord
+			if d, err = dimen(int(op-down1) + 1); err == nil {
+				regs.v += d
+			}
+		case op == y0:
+			regs.v += regs.y
+		case op < z0:
+			if regs.y, err = dimen(int(op-y1) + 1); err == nil {
+				regs.v += regs.y
+			}
+		case op == z0:
+			regs.v += regs.z
+		case op < fntNum0:
+			if regs.z, err = dimen(int(op-z1) + 1); err == nil {
+				regs.v += regs.z
+			}
+		case op < fnt1:
+			err = selectFont(uint32(op - fntNum0))
+		case op < xxx1:
+			var k uint32
+			if k, err = readNbui(r, int(op-fnt1)+1); err == nil {
+				err = selectFont(k)
+			}
+		case op < fntDef1:
+			var k uint32
+			if k, err = readNbui(r, int(op-xxx1)+1); err == nil {
+				special := make([]byte, k)
+				if _, err = io.ReadFull(r, special); err == nil {
+					items = append(items, Item{Kind: SpecialItem, H: regs.h, V: regs.v, Special: special})
+				}
+			}
+		default:
+			return nil, errorf("Opcode %v is not allowed in a packet", op)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errorf("Packet ended in the middle of a command")
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(stack) != 0 {
+		return nil, errorf("Packet ended with %v unmatched pushes", len(stack))
+	}
+	return items, nil
+}
@@ -0,0 +1,172 @@
+package vf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/eddiejessup/gnex/tfm"
+)
+
+// testVF returns a VF file defining one font, cmr10 at its design size, and
+// a short packet for each of packets, mapped from character to width and DVI
+// commands.
+func testVF(packets map[byte]testPacket) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{pre, identifier, 4, 't', 'e', 's', 't'})
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, int32(10*tfm.FixWordUnity))
+	b.Write([]byte{fntDef1, 0})
+	binary.Write(&b, binary.BigEndian, uint32(0))
+	binary.Write(&b, binary.BigEndian, int32(tfm.FixWordUnity))
+	binary.Write(&b, binary.BigEndian, int32(10*tfm.FixWordUnity))
+	b.Write([]byte{0, 5, 'c', 'm', 'r', '1', '0'})
+	for c, p := range packets {
+		b.Write([]byte{byte(len(p.dvi)), c, byte(p.width >> 16), byte(p.width >> 8), byte(p.width)})
+		b.Write(p.dvi)
+	}
+	b.Write([]byte{post, post, post})
+	return b.Bytes()
+}
+
+type testPacket struct {
+	width uint32
+	dvi   []byte
+}
+
+func loadTestVF(t *testing.T, packets map[byte]testPacket) *VirtualFont {
+	t.Helper()
+	f, err := Load(bytes.NewReader(testVF(packets)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.LinkFonts(func(name string) (*tfm.TFM, error) {
+		return tfm.ParsePL(strings.NewReader("(DESIGNSIZE R 10.0)(CHARACTER C A (CHARWD R 0.5))"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestShortPacketWidth(t *testing.T) {
+	tests := []struct {
+		width uint32
+		want  tfm.FixWord
+	}{
+		{0x000010, 0x10},
+		{0x7fffff, 0x7fffff},
+		// The top bit of the three bytes is not a sign.
+		{0x800000, 0x800000},
+		{0xffffff, 0xffffff},
+	}
+	for _, test := range tests {
+		f := loadTestVF(t, map[byte]testPacket{'A': {width: test.width}})
+		if got := f.Packets['A'].Width; got != test.want {
+			t.Errorf("width %#x: got %#x, want %#x", test.width, got, test.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	half := tfm.FixWordUnity / 2
+	tests := []struct {
+		name  string
+		dvi   []byte
+		items []Item
+	}{
+		{"set", []byte{'A', 'A'}, []Item{
+			{Kind: CharItem, Char: 'A'},
+			{Kind: CharItem, H: half, Char: 'A'},
+		}},
+		{"push and pop", []byte{push, down1, 0xfd, put1, 'A', pop, 'A'}, []Item{
+			{Kind: CharItem, V: -3, Char: 'A'},
+			{Kind: CharItem, Char: 'A'},
+		}},
+		{"right", []byte{right1, 5, right1 + 1, 0xff, 0xfe, 'A'}, []Item{
+			{Kind: CharItem, H: 3, Char: 'A'},
+		}},
+		{"w", []byte{w1, 7, w0, 'A'}, []Item{
+			{Kind: CharItem, H: 14, Char: 'A'},
+		}},
+		{"rule", []byte{setRule, 0, 0, 0, 1, 0, 0, 0, 2, 'A'}, []Item{
+			{Kind: RuleItem, Width: 2, Height: 1},
+			{Kind: CharItem, H: 2, Char: 'A'},
+		}},
+		{"special", []byte{xxx1, 2, 'h', 'i'}, []Item{
+			{Kind: SpecialItem, Special: []byte("hi")},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := loadTestVF(t, map[byte]testPacket{'B': {dvi: test.dvi}})
+			items, err := f.Expand('B')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != len(test.items) {
+				t.Fatalf("got %v items, want %v", len(items), len(test.items))
+			}
+			for i, item := range items {
+				want := test.items[i]
+				if item.Kind == CharItem {
+					want.Font = f.Fonts[0]
+				}
+				if item.Kind != want.Kind || item.H != want.H || item.V != want.V ||
+					item.Font != want.Font || item.Char != want.Char ||
+					item.Width != want.Width || item.Height != want.Height ||
+					!bytes.Equal(item.Special, want.Special) {
+					t.Errorf("item %v: got %+v, want %+v", i, item, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandDisallowedOpcodes(t *testing.T) {
+	for _, op := range []byte{bop, eop, fntDef1, pre, post, post + 1, 255} {
+		f := loadTestVF(t, map[byte]testPacket{'B': {dvi: []byte{op, 0, 0, 0, 0}}})
+		_, err := f.Expand('B')
+		if err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("opcode %v: got %v, want it not allowed", op, err)
+		}
+	}
+}
+
+// testVFWith returns testVF(nil) with body written between its font
+// definition and its postamble.
+func testVFWith(body ...[]byte) []byte {
+	bs := testVF(nil)
+	bs = bs[:len(bs)-3]
+	for _, b := range body {
+		bs = append(bs, b...)
+	}
+	return append(bs, post, post, post)
+}
+
+func TestLoadPacketOrder(t *testing.T) {
+	shortPacket := []byte{0, 'A', 0, 0, 0x10}
+	longPacket := []byte{longChar, 0, 0, 0, 0, 0, 0, 0, 'A', 0, 0, 0, 0x10}
+	fontDef := []byte{fntDef1, 1, 0, 0, 0, 0, 0, 0x10, 0, 0, 0, 0xa0, 0, 0, 0, 5, 'c', 'm', 'r', '1', '0'}
+	tests := []struct {
+		name string
+		body [][]byte
+		err  error
+	}{
+		{"packet", [][]byte{shortPacket}, nil},
+		{"font definitions before packets", [][]byte{fontDef, shortPacket}, nil},
+		{"font definition after packet", [][]byte{shortPacket, fontDef}, FontDefOrderError{}},
+		{"duplicate packet", [][]byte{shortPacket, shortPacket}, DuplicatePacketError{}},
+		{"duplicate long packet", [][]byte{shortPacket, longPacket}, DuplicatePacketError{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(bytes.NewReader(testVFWith(test.body...)), nil)
+			if reflect.TypeOf(err) != reflect.TypeOf(test.err) {
+				t.Errorf("got %v, want an error of type %T", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package vfs
+
+import (
+	"io/fs"
+	"sync"
+)
+
+// Access records an attempt to open a file.
+type Access struct {
+	Name string
+	// Err is why the file could not be opened, or nil if it was.
+	Err error
+}
+
+// LogFS is a file system that records every file opened through it, and
+// every attempt to open one, as TeX's -recorder option does. Looking at
+// files and directories without opening them is not recorded. A LogFS is
+// safe for concurrent use.
+type LogFS struct {
+	fsys fs.FS
+
+	mu  sync.Mutex
+	log []Access
+}
+
+// NewLogFS returns a LogFS that opens files in fsys.
+func NewLogFS(fsys fs.FS) *LogFS {
+	return &LogFS{fsys: fsys}
+}
+
+func (l *LogFS) record(name string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = append(l.log, Access{Name: name, Err: err})
+}
+
+func (l *LogFS) Open(name string) (fs.File, error) {
+	file, err := l.fsys.Open(name)
+	l.record(name, err)
+	return file, err
+}
+
+func (l *LogFS) ReadFile(name string) ([]byte, error) {
+	bs, err := fs.ReadFile(l.fsys, name)
+	l.record(name, err)
+	return bs, err
+}
+
+func (l *LogFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(l.fsys, name)
+}
+
+func (l *LogFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(l.fsys, name)
+}
+
+// Accesses returns the attempts to open files, in the order they were made.
+func (l *LogFS) Accesses() []Access {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Access(nil), l.log...)
+}
+
+// Opened returns the names of the files opened, each once, in the order they
+// were first opened.
+func (l *LogFS) Opened() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	seen := make(map[string]bool)
+	var names []string
+	for _, a := range l.log {
+		if a.Err == nil && !seen[a.Name] {
+			seen[a.Name] = true
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+// Reset forgets the accesses recorded so far.
+func (l *LogFS) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = nil
+}
@@ -0,0 +1,210 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemFS is a file system held in memory. Directories are implied by the
+// files in them. Names are as fs.ValidPath requires, except when writing,
+// which cleans them first. A MemFS is safe for concurrent use.
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemFS returns a MemFS holding files, mapped from name to contents.
+func NewMemFS(files map[string][]byte) *MemFS {
+	m := &MemFS{files: make(map[string][]byte)}
+	for name, bs := range files {
+		m.WriteFile(name, bs)
+	}
+	return m
+}
+
+func memName(name string) string {
+	return path.Clean("/" + name)[1:]
+}
+
+// lookupName returns the name under which name is held, if it is valid.
+func lookupName(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return memName(name), nil
+}
+
+// WriteFile makes name hold a copy of bs, replacing anything it held.
+func (m *MemFS) WriteFile(name string, bs []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[memName(name)] = append([]byte(nil), bs...)
+}
+
+// Remove removes the file name, if there is one.
+func (m *MemFS) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, memName(name))
+}
+
+// isDir returns whether name is a directory, which is so if it holds a file.
+func (m *MemFS) isDir(name string) bool {
+	if name == "" {
+		return true
+	}
+	for f := range m.files {
+		if strings.HasPrefix(f, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemFS) Open(name string) (fs.File, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := lookupName("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if bs, ok := m.files[n]; ok {
+		return &memFile{Reader: bytes.NewReader(bs), info: memInfo{name: path.Base(n), size: int64(len(bs))}}, nil
+	}
+	if m.isDir(n) {
+		entries, _ := m.readDir(n)
+		return &dirFile{info: memInfo{name: path.Base(n), dir: true}, entries: entries}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := lookupName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	if bs, ok := m.files[n]; ok {
+		return memInfo{name: path.Base(n), size: int64(len(bs))}, nil
+	}
+	if m.isDir(n) {
+		return memInfo{name: path.Base(n), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := lookupName("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if bs, ok := m.files[n]; ok {
+		return append([]byte(nil), bs...), nil
+	}
+	return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, err := lookupName("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !m.isDir(n) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return m.readDir(n)
+}
+
+// readDir lists the directory dir, whose name is cleaned, in order.
+func (m *MemFS) readDir(dir string) ([]fs.DirEntry, error) {
+	prefix := dir + "/"
+	if dir == "" {
+		prefix = ""
+	}
+	infos := make(map[string]memInfo)
+	for f, bs := range m.files {
+		if !strings.HasPrefix(f, prefix) {
+			continue
+		}
+		rest := f[len(prefix):]
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			infos[rest[:i]] = memInfo{name: rest[:i], dir: true}
+		} else if _, ok := infos[rest]; !ok {
+			infos[rest] = memInfo{name: rest, size: int64(len(bs))}
+		}
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+type memInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return time.Time{} }
+func (i memInfo) IsDir() bool        { return i.dir }
+func (i memInfo) Sys() interface{}   { return nil }
+
+func (i memInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+type memFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memFile) Close() error               { return nil }
+
+// dirFile is an open directory, whose entries are listed when it is opened.
+type dirFile struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
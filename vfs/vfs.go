@@ -0,0 +1,147 @@
+// Package vfs provides the file systems that gex reads its inputs through:
+// that of the operating system, one held in memory, one that overlays
+// others, and one that logs which files were opened. Each is an fs.FS, so
+// any other fs.FS, such as one from os.DirFS or embed, can be used in their
+// place.
+package vfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+type osFS struct{}
+
+// OS is the file system of the operating system. Unlike os.DirFS, it takes
+// names as the os package does, absolute or relative to the working
+// directory, so it can stand in for calls to os.Open.
+var OS fs.FS = osFS{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+func (osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// ReadSeeker opens the file name in fsys as an io.ReadSeeker, reading it into
+// memory if the file system's files cannot seek. The caller must call close
+// once done with it.
+func ReadSeeker(fsys fs.FS, name string) (r io.ReadSeeker, close func() error, err error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rs, ok := file.(io.ReadSeeker); ok {
+		return rs, file.Close, nil
+	}
+	defer file.Close()
+	bs, err := io.ReadAll(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bytes.NewReader(bs), func() error { return nil }, nil
+}
+
+// IsFile returns whether name is a regular file, not a directory, in fsys.
+func IsFile(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+// Overlay is a file system made of layers, each of which hides the files of
+// those after it. A directory holds what it holds in every layer.
+type Overlay []fs.FS
+
+// NewOverlay returns an Overlay whose first layer is on top.
+func NewOverlay(layers ...fs.FS) Overlay {
+	return Overlay(layers)
+}
+
+// notInLayer returns whether err says that a layer does not have a file. A
+// layer that cannot hold a name at all, as a MemFS cannot hold an absolute
+// one, does not have it either, though a layer below may.
+func notInLayer(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid)
+}
+
+// Open opens the file from the highest layer that has it. A directory is
+// opened with the entries ReadDir gives it.
+func (o Overlay) Open(name string) (fs.File, error) {
+	for _, fsys := range o {
+		file, err := fsys.Open(name)
+		if err != nil && notInLayer(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if !info.IsDir() {
+			return file, nil
+		}
+		file.Close()
+		entries, err := o.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &dirFile{info: info, entries: entries}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (o Overlay) Stat(name string) (fs.FileInfo, error) {
+	for _, fsys := range o {
+		info, err := fs.Stat(fsys, name)
+		if err == nil || !notInLayer(err) {
+			return info, err
+		}
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir merges the directory's entries from every layer that has it, an
+// entry in a higher layer hiding those of the same name below it.
+func (o Overlay) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	found := false
+	for _, fsys := range o {
+		layer, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			if notInLayer(err) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, e := range layer {
+			if !seen[e.Name()] {
+				seen[e.Name()] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
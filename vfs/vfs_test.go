@@ -0,0 +1,80 @@
+package vfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMemFS(t *testing.T) {
+	m := NewMemFS(map[string][]byte{
+		"a/b.txt":    []byte("b"),
+		"/a/c/d.tex": []byte("d"),
+		"top":        nil,
+	})
+	if err := fstest.TestFS(m, "a/b.txt", "a/c/d.tex", "top"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	high := NewMemFS(map[string][]byte{"f/x.tex": []byte("high"), "g.tex": []byte("g")})
+	low := NewMemFS(map[string][]byte{"f/x.tex": []byte("low"), "f/y.tex": []byte("y")})
+	o := NewOverlay(high, low)
+	if err := fstest.TestFS(o, "f/x.tex", "f/y.tex", "g.tex"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		contents string
+		ok       bool
+	}{
+		{"f/x.tex", "high", true},
+		{"f/y.tex", "y", true},
+		{"g.tex", "g", true},
+		{"h.tex", "", false},
+	}
+	for _, test := range tests {
+		bs, err := fs.ReadFile(o, test.name)
+		if (err == nil) != test.ok || string(bs) != test.contents {
+			t.Errorf("%v: got %q, %v, want %q", test.name, bs, err, test.contents)
+		}
+	}
+}
+
+func TestOverlayNameOnlyLowerLayerHolds(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.tex")
+	if err := os.WriteFile(file, []byte("real"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	o := NewOverlay(NewMemFS(map[string][]byte{"mem.tex": []byte("mem")}), OS)
+	bs, err := fs.ReadFile(o, file)
+	if err != nil || string(bs) != "real" {
+		t.Errorf("got %q, %v, want \"real\"", bs, err)
+	}
+	if !IsFile(o, file) {
+		t.Errorf("IsFile(%v) is false", file)
+	}
+	if entries, err := fs.ReadDir(o, dir); err != nil || len(entries) != 1 {
+		t.Errorf("got entries %v, %v, want one", entries, err)
+	}
+	if _, err := o.Open(filepath.Join(dir, "missing.tex")); !os.IsNotExist(err) {
+		t.Errorf("got %v, want a not-exist error", err)
+	}
+}
+
+func TestLogFS(t *testing.T) {
+	log := NewLogFS(NewMemFS(map[string][]byte{"a.tex": []byte("a")}))
+	log.Open("missing.tex")
+	fs.ReadFile(log, "a.tex")
+	if got := log.Opened(); !reflect.DeepEqual(got, []string{"a.tex"}) {
+		t.Errorf("opened %v, want [a.tex]", got)
+	}
+	if got := len(log.Accesses()); got != 2 {
+		t.Errorf("got %v accesses, want 2", got)
+	}
+}